@@ -0,0 +1,125 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+// specAnnotation holds the v1beta1 spec of a Mesh that was converted down to
+// v1alpha1, so that fields v1alpha1 cannot represent survive a round trip.
+const specAnnotation = "mesh.com/v1beta1-spec"
+
+// ConvertTo converts this Mesh to the Hub version (v1beta1).
+func (src *Mesh) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.Mesh)
+
+	dst.ObjectMeta = src.ObjectMeta
+	if raw, ok := src.Annotations[specAnnotation]; ok {
+		if err := json.Unmarshal([]byte(raw), &dst.Spec); err != nil {
+			return err
+		}
+		dst.Annotations = make(map[string]string, len(src.Annotations))
+		for k, v := range src.Annotations {
+			if k != specAnnotation {
+				dst.Annotations[k] = v
+			}
+		}
+		if len(dst.Annotations) == 0 {
+			dst.Annotations = nil
+		}
+	}
+
+	// Fields that v1alpha1 can represent always win over the annotation, since
+	// a v1alpha1 client may have changed them.
+	dst.Spec.Replicas = src.Spec.Replicas
+	dst.Spec.Components.Frontend.Image = src.Spec.FrontendImage
+	dst.Spec.Components.Backend.Image = src.Spec.BackendImage
+	dst.Spec.Components.App.Image = src.Spec.AppImage
+
+	dst.Status = v1beta1.MeshStatus{}
+	// In the order of the components in a v1beta1 status, so that converting
+	// the same Mesh always yields the same status.
+	for _, component := range []struct{ name, phase string }{
+		{"frontend", src.Status.FrontendDeploymentStatus},
+		{"backend", src.Status.BackendDeploymentStatus},
+		{"app", src.Status.AppDeploymentStatus},
+	} {
+		if component.phase != "" {
+			dst.Status.Components = append(dst.Status.Components, v1beta1.ComponentStatus{
+				Name:  component.name,
+				Phase: v1beta1.MeshPhase(component.phase),
+			})
+		}
+	}
+
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v1beta1) to this version.
+func (dst *Mesh) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.Mesh)
+
+	dst.ObjectMeta = *src.ObjectMeta.DeepCopy()
+	delete(dst.Annotations, specAnnotation)
+	dst.Spec = MeshSpec{
+		Replicas:      src.Spec.Replicas,
+		FrontendImage: src.Spec.Components.Frontend.Image,
+		BackendImage:  src.Spec.Components.Backend.Image,
+		AppImage:      src.Spec.Components.App.Image,
+	}
+
+	// Keep the full v1beta1 spec around if this version would drop part of it.
+	var down v1beta1.Mesh
+	if err := dst.ConvertTo(&down); err != nil {
+		return err
+	}
+	if !equalSpec(down.Spec, src.Spec) {
+		raw, err := json.Marshal(src.Spec)
+		if err != nil {
+			return err
+		}
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[specAnnotation] = string(raw)
+	}
+
+	dst.Status = MeshStatus{}
+	for _, component := range src.Status.Components {
+		switch component.Name {
+		case "frontend":
+			dst.Status.FrontendDeploymentStatus = string(component.Phase)
+		case "backend":
+			dst.Status.BackendDeploymentStatus = string(component.Phase)
+		case "app":
+			dst.Status.AppDeploymentStatus = string(component.Phase)
+		}
+	}
+
+	return nil
+}
+
+func equalSpec(a, b v1beta1.MeshSpec) bool {
+	rawA, errA := json.Marshal(a)
+	rawB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(rawA) == string(rawB)
+}
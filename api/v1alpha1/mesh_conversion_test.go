@@ -0,0 +1,104 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+func TestMeshConversionRoundTrip(t *testing.T) {
+	original := &Mesh{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "mesh-sample",
+			Namespace:   "default",
+			Annotations: map[string]string{"team": "payments"},
+		},
+		Spec: MeshSpec{
+			Replicas:      3,
+			FrontendImage: "frontend:1.0",
+			BackendImage:  "backend:1.0",
+			AppImage:      "app:1.0",
+		},
+		Status: MeshStatus{
+			FrontendDeploymentStatus: "Ready",
+			BackendDeploymentStatus:  "Progressing",
+			AppDeploymentStatus:      "Pending",
+		},
+	}
+
+	hub := &v1beta1.Mesh{}
+	if err := original.DeepCopy().ConvertTo(hub); err != nil {
+		t.Fatalf("ConvertTo: %v", err)
+	}
+	if hub.Spec.Components.Backend.Image != "backend:1.0" || hub.Spec.Replicas != 3 {
+		t.Fatalf("unexpected v1beta1 spec: %+v", hub.Spec)
+	}
+	var names []string
+	for _, component := range hub.Status.Components {
+		names = append(names, component.Name)
+	}
+	if len(names) != 3 || names[0] != "frontend" || names[1] != "backend" || names[2] != "app" {
+		t.Errorf("v1beta1 status components: got %v, want frontend, backend and app in order", names)
+	}
+
+	converted := &Mesh{}
+	if err := converted.ConvertFrom(hub); err != nil {
+		t.Fatalf("ConvertFrom: %v", err)
+	}
+	if !equality.Semantic.DeepEqual(original, converted) {
+		t.Fatalf("round trip mismatch:\nwant %+v\ngot  %+v", original, converted)
+	}
+}
+
+func TestMeshConversionPreservesHubOnlyFields(t *testing.T) {
+	two := int32(2)
+	original := &v1beta1.Mesh{
+		ObjectMeta: metav1.ObjectMeta{Name: "mesh-sample", Namespace: "default"},
+		Spec: v1beta1.MeshSpec{
+			Replicas: 1,
+			Components: v1beta1.MeshComponents{
+				Frontend: v1beta1.ComponentSpec{ComponentTemplate: v1beta1.ComponentTemplate{Image: "frontend:1.0", Replicas: &two}},
+				Backend:  v1beta1.ComponentSpec{ComponentTemplate: v1beta1.ComponentTemplate{Image: "backend:1.0"}},
+				App:      v1beta1.ComponentSpec{ComponentTemplate: v1beta1.ComponentTemplate{Image: "app:1.0"}},
+			},
+		},
+	}
+
+	spoke := &Mesh{}
+	if err := spoke.ConvertFrom(original.DeepCopy()); err != nil {
+		t.Fatalf("ConvertFrom: %v", err)
+	}
+	if _, ok := spoke.Annotations[specAnnotation]; !ok {
+		t.Fatalf("expected %s annotation on down-converted Mesh", specAnnotation)
+	}
+
+	converted := &v1beta1.Mesh{}
+	if err := spoke.ConvertTo(converted); err != nil {
+		t.Fatalf("ConvertTo: %v", err)
+	}
+	if !equality.Semantic.DeepEqual(original.Spec, converted.Spec) {
+		t.Fatalf("round trip mismatch:\nwant %+v\ngot  %+v", original.Spec, converted.Spec)
+	}
+	if _, ok := converted.Annotations[specAnnotation]; ok {
+		t.Fatalf("%s annotation leaked into v1beta1 Mesh", specAnnotation)
+	}
+}
@@ -0,0 +1,577 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// MeshSpec defines the desired state of Mesh
+type MeshSpec struct {
+	// Replicas is the default replica count of every component that does not
+	// set its own. When neither is set the operator does not manage the
+	// replica count, leaving it to the Deployment default or an autoscaler.
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Paused stops the operator from changing any child object of the Mesh.
+	// Status is still updated. Setting the mesh.com/paused annotation to
+	// "true" has the same effect.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// Template is the name of a MeshTemplate that provides the defaults of
+	// every component. Settings in components override it.
+	// +optional
+	Template string `json:"template,omitempty"`
+
+	// Components holds the configuration of each component of the Mesh.
+	// +optional
+	Components MeshComponents `json:"components,omitempty"`
+
+	// ImagePolicy controls how the images of the components are resolved.
+	// Components rendered from a source are not affected.
+	// +optional
+	ImagePolicy *ImagePolicy `json:"imagePolicy,omitempty"`
+}
+
+// ImagePolicy controls how the images of a Mesh are resolved.
+type ImagePolicy struct {
+	// PinDigests resolves the tag of every image to its digest when the
+	// component is applied, so that all of its pods run the same image
+	// even if the tag is moved. The tag is resolved again on every
+	// reconcile.
+	// +optional
+	PinDigests bool `json:"pinDigests,omitempty"`
+
+	// RejectMutableTags refuses to apply a component whose image is not
+	// referenced by digest.
+	// +optional
+	RejectMutableTags bool `json:"rejectMutableTags,omitempty"`
+
+	// ImagePullSecrets are used to resolve tags in private registries and
+	// to pull the charts of component sources, and are set on the pods of
+	// the components.
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagePullSecrets,omitempty"`
+}
+
+// PausedAnnotation pauses a Mesh when set to "true", like spec.paused.
+const PausedAnnotation = "mesh.com/paused"
+
+// RotateSecretsAnnotation rotates every generated value of a Mesh that has a
+// rotation policy whenever it is set to a value not used before, such as the
+// current time.
+const RotateSecretsAnnotation = "mesh.com/rotate-secrets"
+
+// ShardLabel assigns a Mesh to a shard when Meshes are partitioned across
+// several operator replicas. Meshes without it are assigned by a hash of
+// their UID.
+const ShardLabel = "mesh.com/shard"
+
+// ExternalSecretLabel lets Meshes read a Secret through the kubernetes
+// secret provider when set to "true". Other Secrets cannot be read.
+const ExternalSecretLabel = "mesh.com/external-secret"
+
+// MeshComponents lists the components that make up a Mesh.
+type MeshComponents struct {
+	// +optional
+	Frontend ComponentSpec `json:"frontend,omitempty"`
+	// +optional
+	Backend ComponentSpec `json:"backend,omitempty"`
+	// +optional
+	App ComponentSpec `json:"app,omitempty"`
+}
+
+// ComponentSpec defines the desired state of a single Mesh component.
+type ComponentSpec struct {
+	ComponentTemplate `json:",inline"`
+
+	// Paused stops the operator from changing the child objects of this
+	// component only.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// Source renders the component from a Kustomize directory or a Helm
+	// chart instead of the built-in Deployment, ConfigMap and Secret.
+	// +optional
+	Source *ComponentSource `json:"source,omitempty"`
+
+	// ImageUpdate moves the image of the component to newer tags of its
+	// repository as they are pushed.
+	// +optional
+	ImageUpdate *ImageUpdatePolicy `json:"imageUpdate,omitempty"`
+
+	// GeneratedSecrets are generated into the component's Secret once and
+	// kept stable across reconciles.
+	// +optional
+	// +listType=map
+	// +listMapKey=key
+	GeneratedSecrets []GeneratedSecret `json:"generatedSecrets,omitempty"`
+
+	// ReferencedSecrets are Secrets in the Mesh's namespace that the
+	// component uses but the operator does not manage, such as those of its
+	// env and volumes. The component is restarted when their data changes,
+	// as it is when its generated secrets are rotated.
+	// +optional
+	ReferencedSecrets []corev1.LocalObjectReference `json:"referencedSecrets,omitempty"`
+
+	// ExternalSecrets are read from secret stores into the component's
+	// Secret and refreshed periodically.
+	// +optional
+	// +listType=map
+	// +listMapKey=key
+	ExternalSecrets []ExternalSecret `json:"externalSecrets,omitempty"`
+
+	// ServiceAccount makes the component's pods run as a ServiceAccount of
+	// their own instead of the namespace's default one. They run as the
+	// default ServiceAccount when unset.
+	// +optional
+	ServiceAccount *ComponentServiceAccount `json:"serviceAccount,omitempty"`
+}
+
+// ComponentServiceAccount is the ServiceAccount of a component, named after
+// the component.
+type ComponentServiceAccount struct {
+	// Rules are the permissions of the ServiceAccount in the Mesh's
+	// namespace, granted by a Role and RoleBinding named after the
+	// component. The operator can only grant permissions it holds itself.
+	// +optional
+	Rules []rbacv1.PolicyRule `json:"rules,omitempty"`
+}
+
+// ExternalSecret is a value of a component's Secret read from a secret store.
+type ExternalSecret struct {
+	// Key is the key the value is stored under in the Secret.
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9]([-._a-zA-Z0-9]*[a-zA-Z0-9])?$`
+	Key string `json:"key"`
+
+	// Ref references the value as provider://path#key. The kubernetes
+	// provider reads the key of a Secret in the Mesh's namespace that is
+	// labelled mesh.com/external-secret=true, as in
+	// kubernetes://db-credentials#password; the vault provider reads the
+	// key of a KV version 2 secret, the first path element being the mount,
+	// as in vault://secret/db#password.
+	// +kubebuilder:validation:Pattern=`^[a-z0-9-]+://[^#]+#.+$`
+	Ref string `json:"ref"`
+}
+
+// GeneratedSecret is a value the operator generates into the Secret of a
+// component. Exactly one of password, keyPair and certificate must be set.
+type GeneratedSecret struct {
+	// Key is the key the value is stored under in the Secret. Key pairs are
+	// stored as <key>.key and <key>.pub, certificates as <key>.crt,
+	// <key>.key and <key>.ca.crt, all PEM encoded.
+	// +kubebuilder:validation:MaxLength=63
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9]([-._a-zA-Z0-9]*[a-zA-Z0-9])?$`
+	Key string `json:"key"`
+
+	// Password generates a random password.
+	// +optional
+	Password *PasswordGenerator `json:"password,omitempty"`
+
+	// KeyPair generates a private key and its public key.
+	// +optional
+	KeyPair *KeyPairGenerator `json:"keyPair,omitempty"`
+
+	// Certificate generates a TLS serving certificate for the DNS names of
+	// a Service named after the component.
+	// +optional
+	Certificate *CertificateGenerator `json:"certificate,omitempty"`
+
+	// Rotation generates the value again on a schedule. It is never
+	// rotated when unset.
+	// +optional
+	Rotation *SecretRotation `json:"rotation,omitempty"`
+}
+
+// PasswordGenerator generates random passwords.
+type PasswordGenerator struct {
+	// Length is the number of characters of the password.
+	// +kubebuilder:default=32
+	// +kubebuilder:validation:Minimum=8
+	// +kubebuilder:validation:Maximum=1024
+	// +optional
+	Length int32 `json:"length,omitempty"`
+
+	// Charset holds the characters the password is made of. Defaults to
+	// upper and lower case letters and digits.
+	// +kubebuilder:validation:MinLength=2
+	// +optional
+	Charset string `json:"charset,omitempty"`
+}
+
+// KeyAlgorithm is the algorithm of a generated private key.
+// +kubebuilder:validation:Enum=ECDSA;RSA
+type KeyAlgorithm string
+
+const (
+	KeyAlgorithmECDSA KeyAlgorithm = "ECDSA"
+	KeyAlgorithmRSA   KeyAlgorithm = "RSA"
+)
+
+// KeyPairGenerator generates private keys.
+type KeyPairGenerator struct {
+	// Algorithm of the key.
+	// +kubebuilder:default=ECDSA
+	// +optional
+	Algorithm KeyAlgorithm `json:"algorithm,omitempty"`
+
+	// Size is the size of an RSA key in bits, 2048 by default, or the
+	// curve size of an ECDSA key: 256 (the default), 384 or 521.
+	// +optional
+	Size int32 `json:"size,omitempty"`
+}
+
+// CertificateIssuer is what signs a generated certificate.
+// +kubebuilder:validation:Enum=SelfSigned;CA
+type CertificateIssuer string
+
+const (
+	// CertificateIssuerSelfSigned signs a certificate with its own key.
+	CertificateIssuerSelfSigned CertificateIssuer = "SelfSigned"
+
+	// CertificateIssuerCA signs a certificate with a CA generated for the
+	// Mesh, stored in the Secret <mesh>-ca.
+	CertificateIssuerCA CertificateIssuer = "CA"
+)
+
+// CertificateGenerator generates TLS serving certificates.
+type CertificateGenerator struct {
+	// KeyPair is the private key of the certificate.
+	// +optional
+	KeyPair KeyPairGenerator `json:"keyPair,omitempty"`
+
+	// Issuer signs the certificate.
+	// +kubebuilder:default=CA
+	// +optional
+	Issuer CertificateIssuer `json:"issuer,omitempty"`
+
+	// Validity is how long the certificate is valid. It is renewed when a
+	// third of it is left. Defaults to a year.
+	// +optional
+	Validity *metav1.Duration `json:"validity,omitempty"`
+
+	// DNSNames are the names the certificate is issued for, the first one
+	// being its common name. The operator does not create a Service for a
+	// component, so these are the names of a Service or other host provided
+	// for it, such as backend.team-a.svc.
+	// +kubebuilder:validation:MinItems=1
+	DNSNames []string `json:"dnsNames"`
+}
+
+// SecretRotation is how a generated value is rotated. Besides on its
+// interval, it is rotated whenever the Mesh's mesh.com/rotate-secrets
+// annotation is set to a new value.
+type SecretRotation struct {
+	// Interval is how long a generated value is used before it is
+	// generated again. It is only rotated on demand when unset.
+	// +optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// GracePeriod is how long the previous value stays available after a
+	// rotation, under the keys of the value with a .previous suffix.
+	// +optional
+	GracePeriod *metav1.Duration `json:"gracePeriod,omitempty"`
+}
+
+// ImageUpdatePolicy selects the tags a component's image is updated to.
+type ImageUpdatePolicy struct {
+	// Semver is a semantic version constraint, such as ~1.4, that a tag must
+	// satisfy. The component is updated to the highest such tag that is newer
+	// than its current one.
+	// +kubebuilder:validation:MinLength=1
+	Semver string `json:"semver"`
+
+	// RequireApproval records a newer tag in the component's status as a
+	// pending image instead of updating the Mesh. It is approved by setting
+	// the component's image to it.
+	// +optional
+	RequireApproval bool `json:"requireApproval,omitempty"`
+}
+
+// ComponentSource is where the objects of a component are rendered from.
+// Exactly one of its fields must be set. Paths are relative to the
+// controller's source directory, where ConfigMaps holding the sources are
+// mounted.
+type ComponentSource struct {
+	// Kustomize is the path of a directory holding a kustomization.
+	// +optional
+	Kustomize string `json:"kustomize,omitempty"`
+
+	// Chart is a Helm chart.
+	// +optional
+	Chart *ChartSource `json:"chart,omitempty"`
+}
+
+// ChartSource is a Helm chart and the values it is rendered with.
+type ChartSource struct {
+	// Path is the path of a chart directory or archive.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// Ref is the reference of a chart stored as an OCI artifact, e.g.
+	// oci://registry.example.com/charts/backend:1.2.0.
+	// +optional
+	Ref string `json:"ref,omitempty"`
+
+	// Values override the default values of the chart.
+	// +optional
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	Values *runtime.RawExtension `json:"values,omitempty"`
+}
+
+// ComponentTemplate holds the settings of a component's pods. A Mesh sets them
+// per component, on top of the defaults of its MeshTemplate.
+type ComponentTemplate struct {
+	// Image is the container image of the component. It must be set by the
+	// Mesh or its MeshTemplate.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Replicas overrides the Mesh-wide replica count for this component.
+	// +optional
+	Replicas *int32 `json:"replicas,omitempty"`
+
+	// Resources are the compute resources of the component's container.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// LivenessProbe is the liveness probe of the component's container.
+	// +optional
+	LivenessProbe *corev1.Probe `json:"livenessProbe,omitempty"`
+
+	// ReadinessProbe is the readiness probe of the component's container.
+	// +optional
+	ReadinessProbe *corev1.Probe `json:"readinessProbe,omitempty"`
+
+	// Env are extra environment variables of the component's container,
+	// merged by name.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// Volumes are extra volumes of the component's pods, merged by name.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Volumes []corev1.Volume `json:"volumes,omitempty"`
+
+	// VolumeMounts are extra mounts of the component's container, merged by
+	// mount path.
+	// +optional
+	// +listType=map
+	// +listMapKey=mountPath
+	VolumeMounts []corev1.VolumeMount `json:"volumeMounts,omitempty"`
+}
+
+// ReplicasFor returns the replica count of component, falling back to the
+// Mesh-wide default. It returns nil when neither is set.
+func (s *MeshSpec) ReplicasFor(component ComponentSpec) *int32 {
+	if component.Replicas != nil {
+		return component.Replicas
+	}
+	if s.Replicas > 0 {
+		replicas := s.Replicas
+		return &replicas
+	}
+	return nil
+}
+
+// IsPaused reports whether reconciliation of the whole Mesh is paused, either
+// by spec.paused or by the mesh.com/paused annotation.
+func (m *Mesh) IsPaused() bool {
+	return m.Spec.Paused || m.Annotations[PausedAnnotation] == "true"
+}
+
+// MeshPhase is a summary of the state of a Mesh or one of its components.
+// +kubebuilder:validation:Enum=Pending;Progressing;Ready;Degraded;Failed
+type MeshPhase string
+
+const (
+	// MeshPhasePending means the child objects have not been created yet.
+	MeshPhasePending MeshPhase = "Pending"
+	// MeshPhaseProgressing means a rollout is in progress.
+	MeshPhaseProgressing MeshPhase = "Progressing"
+	// MeshPhaseReady means every desired replica is updated and available.
+	MeshPhaseReady MeshPhase = "Ready"
+	// MeshPhaseDegraded means the rollout finished but some replicas are unavailable.
+	MeshPhaseDegraded MeshPhase = "Degraded"
+	// MeshPhaseFailed means the operator could not reconcile the component.
+	MeshPhaseFailed MeshPhase = "Failed"
+)
+
+// Condition types of a Mesh.
+const (
+	// ConditionConflict is True when a child object could not be applied
+	// because another field manager owns fields the operator sets.
+	ConditionConflict = "Conflict"
+
+	// ConditionPaused is True when the operator is not changing the child
+	// objects of the Mesh or of some of its components.
+	ConditionPaused = "Paused"
+
+	// ConditionImagesVerified is False when the image of a component could
+	// not be verified against the signature keys of the image policy.
+	ConditionImagesVerified = "ImagesVerified"
+
+	// ConditionPolicyCompliant is False when the child objects of a
+	// component violate the operator's policy and were not applied.
+	ConditionPolicyCompliant = "PolicyCompliant"
+)
+
+// ComponentStatus is the observed state of a single Mesh component
+// (frontend, backend or app) and the Deployment that runs it.
+type ComponentStatus struct {
+	// Name of the component.
+	Name string `json:"name"`
+
+	// Phase of the component.
+	Phase MeshPhase `json:"phase,omitempty"`
+
+	// DesiredReplicas is the replica count requested for the component.
+	DesiredReplicas int32 `json:"desiredReplicas"`
+
+	// ReadyReplicas is the number of pods with a Ready condition.
+	ReadyReplicas int32 `json:"readyReplicas"`
+
+	// UpdatedReplicas is the number of pods running the current pod template.
+	UpdatedReplicas int32 `json:"updatedReplicas"`
+
+	// AvailableReplicas is the number of pods available for at least minReadySeconds.
+	AvailableReplicas int32 `json:"availableReplicas"`
+
+	// Image is the image currently set on the component's Deployment.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// ImageDigest is the digest of the image on the component's Deployment,
+	// if it is referenced by digest.
+	// +optional
+	ImageDigest string `json:"imageDigest,omitempty"`
+
+	// PendingImage is a newer image allowed by the component's image update
+	// policy that awaits approval.
+	// +optional
+	PendingImage string `json:"pendingImage,omitempty"`
+
+	// LastImageCheck is when the repository of the component's image was
+	// last listed for newer tags.
+	// +optional
+	LastImageCheck *metav1.Time `json:"lastImageCheck,omitempty"`
+
+	// LastSecretRotation is when the component was last restarted because
+	// its secrets were rotated.
+	// +optional
+	LastSecretRotation *metav1.Time `json:"lastSecretRotation,omitempty"`
+
+	// ConfigHash is a hash of the ConfigMap and Secret data observed for the component.
+	// +optional
+	ConfigHash string `json:"configHash,omitempty"`
+
+	// LastTransitionTime is the last time the component changed phase.
+	// +optional
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// Reason is a CamelCase reason for the component's current phase.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Message is a human readable explanation of the reason, typically a failure.
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// Paused is true while the operator leaves the component's child objects alone.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	// Rendered lists the objects last applied from the component's source,
+	// so that the ones the source no longer renders can be pruned.
+	// +optional
+	Rendered []RenderedObject `json:"rendered,omitempty"`
+}
+
+// RenderedObject identifies an object rendered from a component source, in
+// the namespace of the Mesh.
+type RenderedObject struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+}
+
+// MeshStatus defines the observed state of Mesh
+type MeshStatus struct {
+	// ObservedGeneration is the most recent generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Phase summarises the phases of all components.
+	// +optional
+	Phase MeshPhase `json:"phase,omitempty"`
+
+	// Ready is the number of ready components over the number of components, e.g. "2/3".
+	// +optional
+	Ready string `json:"ready,omitempty"`
+
+	// Components holds the per-component status.
+	// +optional
+	// +listType=map
+	// +listMapKey=name
+	Components []ComponentStatus `json:"components,omitempty"`
+
+	// Conditions are the latest observations of the Mesh's state.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.ready`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// Mesh is the Schema for the meshes API
+type Mesh struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   MeshSpec   `json:"spec,omitempty"`
+	Status MeshStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// MeshList contains a list of Mesh
+type MeshList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Mesh `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Mesh{}, &MeshList{})
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// MeshTemplateSpec defines the component defaults shared by the Meshes that
+// reference the template.
+type MeshTemplateSpec struct {
+	// Components holds the defaults of each component.
+	// +optional
+	Components MeshTemplateComponents `json:"components,omitempty"`
+}
+
+// MeshTemplateComponents lists the defaults of the components of a Mesh.
+type MeshTemplateComponents struct {
+	// +optional
+	Frontend ComponentTemplate `json:"frontend,omitempty"`
+	// +optional
+	Backend ComponentTemplate `json:"backend,omitempty"`
+	// +optional
+	App ComponentTemplate `json:"app,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// MeshTemplate is the Schema for the meshtemplates API. It is cluster-scoped
+// so that platform teams can offer the same defaults to every namespace.
+type MeshTemplate struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec MeshTemplateSpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// MeshTemplateList contains a list of MeshTemplate
+type MeshTemplateList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []MeshTemplate `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&MeshTemplate{}, &MeshTemplateList{})
+}
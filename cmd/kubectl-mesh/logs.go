@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// logs prints the logs of every pod of component, each line prefixed with the
+// name of its pod. With the follow option it streams them until interrupted.
+func (p *plugin) logs(ctx context.Context, name, component string) error {
+	mesh, err := p.getMesh(ctx, name)
+	if err != nil {
+		return err
+	}
+	pods, err := p.pods(ctx, mesh, component)
+	if err != nil {
+		return err
+	}
+	if len(pods) == 0 {
+		return fmt.Errorf("%s has no pods", component)
+	}
+	container := p.options.container
+	if container == "" {
+		container = component
+	}
+	options := &corev1.PodLogOptions{Container: container, Follow: p.options.follow}
+	if p.options.tail >= 0 {
+		options.TailLines = &p.options.tail
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make([]error, len(pods))
+	for i, pod := range pods {
+		wg.Add(1)
+		go func(i int, pod string) {
+			defer wg.Done()
+			stream, err := p.clientset.CoreV1().Pods(mesh.Namespace).GetLogs(pod, options).Stream(ctx)
+			if err != nil {
+				errs[i] = fmt.Errorf("pod %s: %w", pod, err)
+				return
+			}
+			defer stream.Close()
+			scanner := bufio.NewScanner(stream)
+			for scanner.Scan() {
+				mu.Lock()
+				fmt.Fprintf(p.out, "[%s] %s\n", pod, scanner.Text())
+				mu.Unlock()
+			}
+			if err := scanner.Err(); err != nil && ctx.Err() == nil {
+				errs[i] = fmt.Errorf("pod %s: %w", pod, err)
+			}
+		}(i, pod.Name)
+	}
+	wg.Wait()
+	return utilerrors.NewAggregate(errs)
+}
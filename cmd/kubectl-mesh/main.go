@@ -0,0 +1,218 @@
+// Command kubectl-mesh is a kubectl plugin for the day-to-day operation of
+// Meshes. Installed on the PATH, it runs as kubectl mesh.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+const usage = `Operate Meshes.
+
+Usage:
+  kubectl mesh status <mesh>                        Show the components of a Mesh and their pods.
+  kubectl mesh restart <mesh> [component]           Restart the pods of a component, or of all components.
+  kubectl mesh rollback <mesh> <component>          Deploy the image of the previous revision of a component.
+  kubectl mesh pause <mesh> [component]             Stop reconciling a Mesh or one of its components.
+  kubectl mesh resume <mesh> [component]            Reconcile a paused Mesh or component again.
+  kubectl mesh logs <mesh> <component>              Print the logs of all pods of a component.
+
+Flags:
+`
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(v1beta1.AddToScheme(scheme))
+}
+
+// options are the flags of all commands.
+type options struct {
+	kubeconfig string
+	context    string
+	namespace  string
+	follow     bool
+	tail       int64
+	container  string
+	toRevision int64
+}
+
+// plugin runs the commands against the Meshes of a namespace.
+type plugin struct {
+	// client reads and patches Meshes and their children.
+	client client.Client
+	// clientset streams pod logs, which client cannot.
+	clientset kubernetes.Interface
+	namespace string
+	out       io.Writer
+	options   options
+}
+
+func main() {
+	var opts options
+	flags := flag.NewFlagSet("kubectl-mesh", flag.ExitOnError)
+	flags.StringVar(&opts.kubeconfig, "kubeconfig", "", "The kubeconfig file to use. Defaults to $KUBECONFIG or ~/.kube/config.")
+	flags.StringVar(&opts.context, "context", "", "The kubeconfig context to use.")
+	flags.StringVar(&opts.namespace, "n", "", "The namespace of the Mesh. Defaults to the namespace of the context.")
+	flags.StringVar(&opts.namespace, "namespace", "", "The namespace of the Mesh. Defaults to the namespace of the context.")
+	flags.BoolVar(&opts.follow, "f", false, "logs: Stream the logs.")
+	flags.BoolVar(&opts.follow, "follow", false, "logs: Stream the logs.")
+	flags.Int64Var(&opts.tail, "tail", -1, "logs: The number of recent lines to print of every pod. All lines when negative.")
+	flags.StringVar(&opts.container, "c", "", "logs: The container to print the logs of. Defaults to the component's container.")
+	flags.Int64Var(&opts.toRevision, "to-revision", 0, "rollback: The revision of the Deployment to roll back to. Defaults to the last one with another image.")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	args, err := parseInterspersed(flags, os.Args[1:])
+	if err != nil {
+		fail(err)
+	}
+	if len(args) < 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = opts.kubeconfig
+	config := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, &clientcmd.ConfigOverrides{CurrentContext: opts.context})
+	restConfig, err := config.ClientConfig()
+	if err != nil {
+		fail(err)
+	}
+	p := &plugin{namespace: opts.namespace, out: os.Stdout, options: opts}
+	if p.namespace == "" {
+		if p.namespace, _, err = config.Namespace(); err != nil {
+			fail(err)
+		}
+	}
+	if p.client, err = client.New(restConfig, client.Options{Scheme: scheme}); err != nil {
+		fail(err)
+	}
+	if p.clientset, err = kubernetes.NewForConfig(restConfig); err != nil {
+		fail(err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	if err := p.run(ctx, args[0], args[1:]); err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	os.Exit(1)
+}
+
+// parseInterspersed parses flags that may come before, between or after the
+// positional arguments, as kubectl allows, and returns the positional ones.
+func parseInterspersed(flags *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+		if flags.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+// run runs command with args, which start with the name of the Mesh.
+func (p *plugin) run(ctx context.Context, command string, args []string) error {
+	name, args := args[0], args[1:]
+	var component string
+	if len(args) > 0 {
+		component = args[0]
+		if err := checkComponent(component); err != nil {
+			return err
+		}
+	}
+	if len(args) > 1 {
+		return fmt.Errorf("unexpected arguments %v", args[1:])
+	}
+
+	switch command {
+	case "status":
+		if component != "" {
+			return fmt.Errorf("status takes no component")
+		}
+		return p.status(ctx, name)
+	case "restart":
+		return p.restart(ctx, name, component)
+	case "rollback":
+		if component == "" {
+			return errors.New("rollback needs a component")
+		}
+		return p.rollback(ctx, name, component)
+	case "pause":
+		return p.setPaused(ctx, name, component, true)
+	case "resume":
+		return p.setPaused(ctx, name, component, false)
+	case "logs":
+		if component == "" {
+			return errors.New("logs needs a component")
+		}
+		return p.logs(ctx, name, component)
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+func checkComponent(component string) error {
+	for _, name := range render.ComponentNames {
+		if component == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown component %q, want one of %v", component, render.ComponentNames)
+}
+
+// getMesh returns the Mesh name in the namespace of p.
+func (p *plugin) getMesh(ctx context.Context, name string) (*v1beta1.Mesh, error) {
+	mesh := &v1beta1.Mesh{}
+	if err := p.client.Get(ctx, types.NamespacedName{Name: name, Namespace: p.namespace}, mesh); err != nil {
+		return nil, err
+	}
+	return mesh, nil
+}
+
+// deployment returns the Deployment of a built-in component of mesh. It fails
+// for components rendered from a source, whose objects the plugin does not
+// know.
+func (p *plugin) deployment(ctx context.Context, mesh *v1beta1.Mesh, component string) (*appsv1.Deployment, error) {
+	if render.ComponentSpec(mesh, component).Source != nil {
+		return nil, fmt.Errorf("component %s is rendered from a source", component)
+	}
+	deployment := &appsv1.Deployment{}
+	if err := p.client.Get(ctx, types.NamespacedName{Name: component, Namespace: mesh.Namespace}, deployment); err != nil {
+		return nil, err
+	}
+	if !metav1.IsControlledBy(deployment, mesh) {
+		return nil, fmt.Errorf("Deployment %s is not controlled by Mesh %s", component, mesh.Name)
+	}
+	return deployment, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+// newTestPlugin returns a plugin for the default namespace whose clients hold
+// a Mesh named mesh-sample with the Deployment, ReplicaSets and pods of its
+// frontend, which runs frontend:2.0 in revision 2 after frontend:1.0.
+func newTestPlugin(t *testing.T) (*plugin, *bytes.Buffer) {
+	t.Helper()
+	mesh := &v1beta1.Mesh{
+		ObjectMeta: metav1.ObjectMeta{Name: "mesh-sample", Namespace: "default", UID: "mesh-uid"},
+		Spec: v1beta1.MeshSpec{Components: v1beta1.MeshComponents{
+			Frontend: v1beta1.ComponentSpec{ComponentTemplate: v1beta1.ComponentTemplate{Image: "frontend:2.0"}},
+			Backend:  v1beta1.ComponentSpec{ComponentTemplate: v1beta1.ComponentTemplate{Image: "backend:1.0"}},
+			App:      v1beta1.ComponentSpec{ComponentTemplate: v1beta1.ComponentTemplate{Image: "app:1.0"}},
+		}},
+		Status: v1beta1.MeshStatus{
+			Phase: v1beta1.MeshPhase("Degraded"),
+			Ready: "0/3",
+			Components: []v1beta1.ComponentStatus{{
+				Name: render.Frontend, Phase: v1beta1.MeshPhase("Progressing"), DesiredReplicas: 2, ReadyReplicas: 1,
+				Image: "frontend:2.0",
+			}},
+		},
+	}
+	deployment := render.Deployment(mesh.Namespace, render.Frontend, render.ComponentSpec(mesh, render.Frontend), nil)
+	deployment.UID = "deployment-uid"
+	deployment.Annotations = map[string]string{revisionAnnotation: "2"}
+	deployment.OwnerReferences = []metav1.OwnerReference{*metav1.NewControllerRef(mesh, v1beta1.GroupVersion.WithKind("Mesh"))}
+	objects := []client.Object{mesh, deployment}
+	for revision, image := range map[string]string{"1": "frontend:1.0", "2": "frontend:2.0"} {
+		objects = append(objects, &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "frontend-" + revision, Namespace: mesh.Namespace,
+				Labels:          map[string]string{"app": render.Frontend},
+				Annotations:     map[string]string{revisionAnnotation: revision},
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(deployment, appsv1.SchemeGroupVersion.WithKind("Deployment"))},
+			},
+			Spec: appsv1.ReplicaSetSpec{Template: corev1.PodTemplateSpec{Spec: corev1.PodSpec{
+				Containers: []corev1.Container{{Name: render.Frontend, Image: image}},
+			}}},
+		})
+	}
+	var pods []client.Object
+	for i, ready := range []corev1.ConditionStatus{corev1.ConditionTrue, corev1.ConditionFalse} {
+		pods = append(pods, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "frontend-" + string(rune('a'+i)), Namespace: mesh.Namespace,
+				Labels: map[string]string{"app": render.Frontend},
+			},
+			Status: corev1.PodStatus{
+				Conditions:        []corev1.PodCondition{{Type: corev1.PodReady, Status: ready}},
+				ContainerStatuses: []corev1.ContainerStatus{{Name: render.Frontend, RestartCount: 3}},
+			},
+		})
+	}
+
+	out := &bytes.Buffer{}
+	p := &plugin{
+		client:    fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(objects, pods...)...).Build(),
+		clientset: kubefake.NewSimpleClientset(pods[0].(*corev1.Pod), pods[1].(*corev1.Pod)),
+		namespace: mesh.Namespace,
+		out:       out,
+		options:   options{tail: -1},
+	}
+	return p, out
+}
+
+func TestStatus(t *testing.T) {
+	p, out := newTestPlugin(t)
+	if err := p.run(context.Background(), "status", []string{"mesh-sample"}); err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if !strings.HasPrefix(lines[0], "Mesh default/mesh-sample: Degraded, 0/3 components ready") {
+		t.Errorf("summary: got %q", lines[0])
+	}
+	var frontend string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "frontend ") {
+			frontend = line
+		}
+	}
+	if fields := strings.Fields(frontend); len(fields) < 7 || fields[1] != "Progressing" || fields[2] != "1/2" || fields[4] != "1/2" || fields[5] != "6" || fields[6] != "frontend:2.0" {
+		t.Errorf("frontend row: got %q, want its phase, replicas, 1 of 2 pods ready, 6 restarts and its image", frontend)
+	}
+}
+
+func TestRestartAndRollback(t *testing.T) {
+	ctx := context.Background()
+	p, out := newTestPlugin(t)
+	key := types.NamespacedName{Name: render.Frontend, Namespace: "default"}
+
+	if err := p.run(ctx, "restart", []string{"mesh-sample", render.Frontend}); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	deployment := &appsv1.Deployment{}
+	if err := p.client.Get(ctx, key, deployment); err != nil {
+		t.Fatal(err)
+	}
+	if deployment.Spec.Template.Annotations[restartedAtAnnotation] == "" {
+		t.Errorf("restart did not annotate the pod template: %v", deployment.Spec.Template.Annotations)
+	}
+	if err := p.run(ctx, "restart", []string{"mesh-sample", render.Backend}); err == nil {
+		t.Errorf("restart of a component without a Deployment succeeded")
+	}
+
+	if err := p.run(ctx, "rollback", []string{"mesh-sample", render.Frontend}); err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	mesh := &v1beta1.Mesh{}
+	if err := p.client.Get(ctx, types.NamespacedName{Name: "mesh-sample", Namespace: "default"}, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if image := mesh.Spec.Components.Frontend.Image; image != "frontend:1.0" {
+		t.Errorf("rolled back image: got %s, want frontend:1.0 of revision 1", image)
+	}
+	if !strings.Contains(out.String(), "frontend rolled back to revision 1: frontend:1.0") {
+		t.Errorf("output: got %q", out.String())
+	}
+
+	p.options.toRevision = 2
+	if err := p.run(ctx, "rollback", []string{"mesh-sample", render.Frontend}); err == nil {
+		t.Errorf("rollback to the revision of the current image succeeded")
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	ctx := context.Background()
+	p, _ := newTestPlugin(t)
+	key := types.NamespacedName{Name: "mesh-sample", Namespace: "default"}
+	mesh := &v1beta1.Mesh{}
+
+	if err := p.run(ctx, "pause", []string{"mesh-sample", render.App}); err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	if err := p.client.Get(ctx, key, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if !mesh.Spec.Components.App.Paused || mesh.IsPaused() {
+		t.Errorf("pausing app: got app paused %v and Mesh paused %v", mesh.Spec.Components.App.Paused, mesh.IsPaused())
+	}
+
+	mesh.Annotations = map[string]string{v1beta1.PausedAnnotation: "true"}
+	if err := p.client.Update(ctx, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.run(ctx, "resume", []string{"mesh-sample"}); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	if err := p.client.Get(ctx, key, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if mesh.IsPaused() {
+		t.Errorf("Mesh is still paused: %v", mesh.Annotations)
+	}
+	if !mesh.Spec.Components.App.Paused {
+		t.Errorf("resuming the Mesh resumed app")
+	}
+}
+
+func TestLogs(t *testing.T) {
+	p, out := newTestPlugin(t)
+	if err := p.run(context.Background(), "logs", []string{"mesh-sample", render.Frontend}); err != nil {
+		t.Fatalf("logs: %v", err)
+	}
+	for _, pod := range []string{"frontend-a", "frontend-b"} {
+		if !strings.Contains(out.String(), "["+pod+"] ") {
+			t.Errorf("logs of %s missing from %q", pod, out.String())
+		}
+	}
+}
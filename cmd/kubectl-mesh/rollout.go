@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+const (
+	// restartedAtAnnotation is the pod template annotation kubectl rollout
+	// restart sets. The operator does not apply it, so it is left alone.
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+	// revisionAnnotation holds the revision of a Deployment and of its
+	// ReplicaSets.
+	revisionAnnotation = "deployment.kubernetes.io/revision"
+)
+
+// restart restarts the pods of component, or of every built-in component of
+// the Mesh if component is empty, as kubectl rollout restart does.
+func (p *plugin) restart(ctx context.Context, name, component string) error {
+	mesh, err := p.getMesh(ctx, name)
+	if err != nil {
+		return err
+	}
+	components := []string{component}
+	if component == "" {
+		components = nil
+		for _, name := range render.ComponentNames {
+			if render.ComponentSpec(mesh, name).Source == nil {
+				components = append(components, name)
+			}
+		}
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	for _, component := range components {
+		deployment, err := p.deployment(ctx, mesh, component)
+		if err != nil {
+			return err
+		}
+		patch := map[string]interface{}{"spec": map[string]interface{}{"template": map[string]interface{}{
+			"metadata": map[string]interface{}{"annotations": map[string]string{restartedAtAnnotation: now}},
+		}}}
+		if err := p.mergePatch(ctx, deployment, patch); err != nil {
+			return err
+		}
+		fmt.Fprintf(p.out, "%s restarted\n", component)
+	}
+	return nil
+}
+
+// rollback sets the image of component in the Mesh spec to the image of an
+// earlier revision of its Deployment: toRevision if set, or else the latest
+// revision with another image than the current one. Rolling back the
+// Deployment itself would only be reverted by the operator.
+func (p *plugin) rollback(ctx context.Context, name, component string) error {
+	mesh, err := p.getMesh(ctx, name)
+	if err != nil {
+		return err
+	}
+	deployment, err := p.deployment(ctx, mesh, component)
+	if err != nil {
+		return err
+	}
+	current := containerImage(deployment.Spec.Template.Spec.Containers, component)
+	revision, image, err := p.previousImage(ctx, deployment, component, current, p.options.toRevision)
+	if err != nil {
+		return err
+	}
+
+	patch := map[string]interface{}{"spec": map[string]interface{}{"components": map[string]interface{}{
+		component: map[string]string{"image": image},
+	}}}
+	if err := p.mergePatch(ctx, mesh, patch); err != nil {
+		return err
+	}
+	fmt.Fprintf(p.out, "%s rolled back to revision %d: %s\n", component, revision, image)
+	if mesh.IsPaused() || render.ComponentSpec(mesh, component).Paused {
+		fmt.Fprintf(p.out, "%s is paused; the image is deployed when it is resumed\n", component)
+	}
+	return nil
+}
+
+// previousImage returns the revision and image of the ReplicaSet of
+// deployment to roll back to.
+func (p *plugin) previousImage(ctx context.Context, deployment *appsv1.Deployment, component, current string, toRevision int64) (int64, string, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return 0, "", err
+	}
+	replicaSets := &appsv1.ReplicaSetList{}
+	if err := p.client.List(ctx, replicaSets, client.InNamespace(deployment.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return 0, "", err
+	}
+	currentRevision, _ := strconv.ParseInt(deployment.Annotations[revisionAnnotation], 10, 64)
+
+	type revision struct {
+		number int64
+		image  string
+	}
+	var revisions []revision
+	for _, rs := range replicaSets.Items {
+		if !metav1.IsControlledBy(&rs, deployment) {
+			continue
+		}
+		number, err := strconv.ParseInt(rs.Annotations[revisionAnnotation], 10, 64)
+		if err != nil {
+			continue
+		}
+		revisions = append(revisions, revision{number, containerImage(rs.Spec.Template.Spec.Containers, component)})
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].number > revisions[j].number })
+
+	for _, r := range revisions {
+		switch {
+		case toRevision > 0 && r.number == toRevision:
+			if r.image == current {
+				return 0, "", fmt.Errorf("revision %d runs the current image %s", toRevision, current)
+			}
+			return r.number, r.image, nil
+		case toRevision == 0 && r.number < currentRevision && r.image != current && r.image != "":
+			return r.number, r.image, nil
+		}
+	}
+	if toRevision > 0 {
+		return 0, "", fmt.Errorf("Deployment %s has no revision %d", deployment.Name, toRevision)
+	}
+	return 0, "", fmt.Errorf("Deployment %s has no earlier revision with another image than %s", deployment.Name, current)
+}
+
+// containerImage returns the image of the container of a component.
+func containerImage(containers []corev1.Container, component string) string {
+	for _, container := range containers {
+		if container.Name == component {
+			return container.Image
+		}
+	}
+	return ""
+}
+
+// setPaused pauses or resumes the Mesh, or only component if it is set.
+// Resuming the Mesh also removes the paused annotation.
+func (p *plugin) setPaused(ctx context.Context, name, component string, paused bool) error {
+	mesh, err := p.getMesh(ctx, name)
+	if err != nil {
+		return err
+	}
+	var value interface{}
+	if paused {
+		value = true
+	}
+	patch := map[string]interface{}{"spec": map[string]interface{}{"paused": value}}
+	target := "Mesh " + mesh.Name
+	if component != "" {
+		patch = map[string]interface{}{"spec": map[string]interface{}{"components": map[string]interface{}{
+			component: map[string]interface{}{"paused": value},
+		}}}
+		target = component
+	} else if !paused {
+		patch["metadata"] = map[string]interface{}{"annotations": map[string]interface{}{v1beta1.PausedAnnotation: nil}}
+	}
+	if err := p.mergePatch(ctx, mesh, patch); err != nil {
+		return err
+	}
+	verb := "resumed"
+	if paused {
+		verb = "paused"
+	}
+	fmt.Fprintf(p.out, "%s %s\n", target, verb)
+	return nil
+}
+
+// mergePatch applies patch to obj as a JSON merge patch.
+func (p *plugin) mergePatch(ctx context.Context, obj client.Object, patch map[string]interface{}) error {
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return err
+	}
+	return p.client.Patch(ctx, obj, client.RawPatch(types.MergePatchType, data))
+}
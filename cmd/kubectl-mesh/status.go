@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+// status prints the phase and conditions of a Mesh and a table of its
+// components, with their replicas from the Mesh status and their pods.
+func (p *plugin) status(ctx context.Context, name string) error {
+	mesh, err := p.getMesh(ctx, name)
+	if err != nil {
+		return err
+	}
+	phase := string(mesh.Status.Phase)
+	if phase == "" {
+		phase = "Unknown"
+	}
+	paused := ""
+	if mesh.IsPaused() {
+		paused = ", paused"
+	}
+	fmt.Fprintf(p.out, "Mesh %s/%s: %s, %s components ready%s\n\n", mesh.Namespace, mesh.Name, phase, mesh.Status.Ready, paused)
+
+	w := tabwriter.NewWriter(p.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "COMPONENT\tPHASE\tREADY\tUP-TO-DATE\tPODS\tRESTARTS\tIMAGE\tMESSAGE")
+	for _, component := range render.ComponentNames {
+		status := componentStatus(mesh, component)
+		phase := string(status.Phase)
+		if render.ComponentSpec(mesh, component).Paused {
+			phase += " (paused)"
+		}
+		pods, restarts, err := p.podSummary(ctx, mesh, component)
+		if err != nil {
+			return err
+		}
+		image := status.Image
+		if status.PendingImage != "" {
+			image += " (" + status.PendingImage + " pending)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d/%d\t%d\t%s\t%d\t%s\t%s\n", component, phase,
+			status.ReadyReplicas, status.DesiredReplicas, status.UpdatedReplicas, pods, restarts, image, status.Message)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(mesh.Status.Conditions) == 0 {
+		return nil
+	}
+	fmt.Fprintln(p.out)
+	w = tabwriter.NewWriter(p.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CONDITION\tSTATUS\tREASON\tMESSAGE")
+	for _, condition := range mesh.Status.Conditions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", condition.Type, condition.Status, condition.Reason, condition.Message)
+	}
+	return w.Flush()
+}
+
+// componentStatus returns the status of component in the status of mesh.
+func componentStatus(mesh *v1beta1.Mesh, component string) v1beta1.ComponentStatus {
+	for _, status := range mesh.Status.Components {
+		if status.Name == component {
+			return status
+		}
+	}
+	return v1beta1.ComponentStatus{Name: component}
+}
+
+// podSummary returns the number of ready pods over the number of pods of a
+// component, and the sum of the restarts of their containers. Components
+// rendered from a source and components without a Deployment have none.
+func (p *plugin) podSummary(ctx context.Context, mesh *v1beta1.Mesh, component string) (string, int32, error) {
+	if render.ComponentSpec(mesh, component).Source != nil {
+		return "-", 0, nil
+	}
+	pods, err := p.pods(ctx, mesh, component)
+	if errors.IsNotFound(err) {
+		return "0/0", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	var ready int
+	var restarts int32
+	for _, pod := range pods {
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == corev1.PodReady && condition.Status == corev1.ConditionTrue {
+				ready++
+			}
+		}
+		for _, container := range pod.Status.ContainerStatuses {
+			restarts += container.RestartCount
+		}
+	}
+	return fmt.Sprintf("%d/%d", ready, len(pods)), restarts, nil
+}
+
+// pods returns the pods of the Deployment of a component.
+func (p *plugin) pods(ctx context.Context, mesh *v1beta1.Mesh, component string) ([]corev1.Pod, error) {
+	deployment, err := p.deployment(ctx, mesh, component)
+	if err != nil {
+		return nil, err
+	}
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	pods := &corev1.PodList{}
+	if err := p.client.List(ctx, pods, client.InNamespace(mesh.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
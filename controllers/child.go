@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	logr "github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+// fieldManager is the field manager the operator applies child objects as.
+const fieldManager = "mesh-operator"
+
+// appliedHashAnnotation is the annotation of a child object that holds a hash
+// of the desired state the operator last applied, so that changes made by
+// others can be told apart from changes of the desired state.
+const appliedHashAnnotation = "mesh.com/applied-hash"
+
+// reconcileChild server-side applies obj, the desired state of a child of
+// instance that belongs to component. obj must only set the fields the
+// operator owns: fields it leaves out, such as replicas managed by an
+// autoscaler, stay with their current manager. The owner reference is added
+// before applying.
+//
+// Unless ForceOwnership is set, a field owned by another manager with a
+// different value makes the apply fail with a reasonApplyConflict error
+// rather than overwrite it. The first apply after a component is resumed is
+// always forced, so that changes made while it was paused are reverted.
+//
+// reconcileChild logs and records an Event for every create and update and
+// returns what it did. An update is reported as a corrected drift only if
+// the desired state is the one applied last, so that the live object must
+// have been changed by someone else.
+func (r *MeshReconciler) reconcileChild(ctx context.Context, log logr.Logger, instance *v1beta1.Mesh, component string, obj client.Object) (controllerutil.OperationResult, error) {
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	// Apply patches are sent as is, so they need their type.
+	obj.GetObjectKind().SetGroupVersionKind(gvk)
+	kind := gvk.Kind
+	log = log.WithValues(kind+".Namespace", obj.GetNamespace(), kind+".Name", obj.GetName())
+
+	if err := ctrl.SetControllerReference(instance, obj, r.Scheme); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	hash, err := appliedHash(obj)
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	annotations := map[string]string{}
+	for key, value := range obj.GetAnnotations() {
+		annotations[key] = value
+	}
+	annotations[appliedHashAnnotation] = hash
+	obj.SetAnnotations(annotations)
+
+	current := obj.DeepCopyObject().(client.Object)
+	err = r.Client.Get(ctx, client.ObjectKeyFromObject(obj), current)
+	if err != nil && !errors.IsNotFound(err) {
+		log.Error(err, "Failed to get "+kind)
+		return controllerutil.OperationResultNone, &componentError{component, reasonGetFailed, err}
+	}
+	exists := err == nil
+
+	opts := []client.PatchOption{client.FieldOwner(fieldManager)}
+	if r.ForceOwnership || resumed(instance, component) {
+		opts = append(opts, client.ForceOwnership)
+	}
+	if err := r.Client.Patch(ctx, obj, client.Apply, opts...); err != nil {
+		reason := reasonCreateFailed
+		switch {
+		case errors.IsConflict(err):
+			reason = reasonApplyConflict
+		case exists:
+			reason = reasonUpdateFailed
+		}
+		log.Error(err, "Failed to apply "+kind)
+		return controllerutil.OperationResultNone, &componentError{component, reason, err}
+	}
+
+	switch {
+	case !exists:
+		log.Info("Created a new " + kind)
+		r.Recorder.Eventf(instance, corev1.EventTypeNormal, reasonCreated, "Created %s %s", kind, obj.GetName())
+		return controllerutil.OperationResultCreated, nil
+	case obj.GetResourceVersion() != current.GetResourceVersion():
+		if current.GetAnnotations()[appliedHashAnnotation] == hash {
+			log.Info("Corrected drift of " + kind)
+			r.Recorder.Eventf(instance, corev1.EventTypeNormal, reasonDriftCorrected, "Reverted external changes to %s %s", kind, obj.GetName())
+		} else {
+			log.Info("Updated " + kind)
+			r.Recorder.Eventf(instance, corev1.EventTypeNormal, reasonUpdated, "Updated %s %s", kind, obj.GetName())
+		}
+		return controllerutil.OperationResultUpdated, nil
+	}
+	return controllerutil.OperationResultNone, nil
+}
+
+// appliedHash returns a hash of obj, the desired state of a child object,
+// leaving out its appliedHashAnnotation.
+func appliedHash(obj client.Object) (string, error) {
+	content, err := toUnstructured(obj)
+	if err != nil {
+		return "", err
+	}
+	content = runtime.DeepCopyJSON(content)
+	unstructured.RemoveNestedField(content, "metadata", "annotations", appliedHashAnnotation)
+	data, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// resumed reports whether component was paused when the Mesh was last
+// reconciled.
+func resumed(instance *v1beta1.Mesh, component string) bool {
+	for _, status := range instance.Status.Components {
+		if status.Name == component {
+			return status.Paused
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+func TestReconcileChild(t *testing.T) {
+	ctx := context.Background()
+	mesh := newTestMesh()
+	r := newTestReconciler(t, mesh)
+
+	apply := func(image string) controllerutil.OperationResult {
+		t.Helper()
+		op, err := r.reconcileChild(ctx, ctrl.Log, mesh, render.Frontend, render.Deployment(mesh.Namespace, render.Frontend, v1beta1.ComponentSpec{ComponentTemplate: v1beta1.ComponentTemplate{Image: image}}, nil))
+		if err != nil {
+			t.Fatalf("reconcileChild: %v", err)
+		}
+		return op
+	}
+
+	if op := apply("frontend:1.0"); op != controllerutil.OperationResultCreated {
+		t.Fatalf("first pass: got %q, want %q", op, controllerutil.OperationResultCreated)
+	}
+	if op := apply("frontend:1.0"); op != controllerutil.OperationResultNone {
+		t.Fatalf("unchanged pass: got %q, want %q", op, controllerutil.OperationResultNone)
+	}
+	if op := apply("frontend:2.0"); op != controllerutil.OperationResultUpdated {
+		t.Fatalf("changed pass: got %q, want %q", op, controllerutil.OperationResultUpdated)
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: render.Frontend, Namespace: mesh.Namespace}, deployment); err != nil {
+		t.Fatal(err)
+	}
+	if got := deployment.Spec.Template.Spec.Containers[0].Image; got != "frontend:2.0" {
+		t.Errorf("image: got %q, want frontend:2.0", got)
+	}
+	if deployment.Spec.Replicas != nil {
+		t.Errorf("replicas: got %d, want them left unset", *deployment.Spec.Replicas)
+	}
+	if !metav1.IsControlledBy(deployment, mesh) {
+		t.Errorf("Deployment is not controlled by the Mesh: %v", deployment.OwnerReferences)
+	}
+}
+
+func TestReconcileApplyConflict(t *testing.T) {
+	ctx := context.Background()
+	r := newTestReconciler(t, newTestMesh())
+
+	// Fail every apply that is not forced, as the API server does when
+	// another manager owns a field with a different value.
+	var forced bool
+	r.Client = interceptor.NewClient(r.Client.(client.WithWatch), interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			patchOpts := &client.PatchOptions{}
+			patchOpts.ApplyOptions(opts)
+			forced = patchOpts.Force != nil && *patchOpts.Force
+			if patchOpts.FieldManager != fieldManager {
+				t.Errorf("field manager: got %q, want %q", patchOpts.FieldManager, fieldManager)
+			}
+			if !forced {
+				return errors.NewApplyConflict([]metav1.StatusCause{{
+					Type:    metav1.CauseTypeFieldManagerConflict,
+					Message: `conflict with "kubectl-edit"`,
+					Field:   ".spec.template.spec.containers[name=\"frontend\"].image",
+				}}, `Apply failed with 1 conflict: conflict with "kubectl-edit": .spec.template.spec.containers[name="frontend"].image`)
+			}
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+	})
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "mesh-sample", Namespace: "default"}}
+	_, err := r.Reconcile(ctx, request)
+	errs := splitErrors(err)
+	if len(errs) != len(render.ComponentNames) {
+		t.Fatalf("Reconcile: got %v, want a conflict for every component", err)
+	}
+	for _, err := range errs {
+		if errorReason(err) != reasonApplyConflict {
+			t.Errorf("Reconcile: got %v, want an %s error", err, reasonApplyConflict)
+		}
+	}
+	mesh := &v1beta1.Mesh{}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionTrue(mesh.Status.Conditions, v1beta1.ConditionConflict) {
+		t.Errorf("Conflict condition not set: %v", mesh.Status.Conditions)
+	}
+	if mesh.Status.Components[0].Reason != reasonApplyConflict {
+		t.Errorf("frontend reason: got %q, want %q", mesh.Status.Components[0].Reason, reasonApplyConflict)
+	}
+
+	r.ForceOwnership = true
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("forced Reconcile: %v", err)
+	}
+	if !forced {
+		t.Errorf("apply was not forced")
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionFalse(mesh.Status.Conditions, v1beta1.ConditionConflict) {
+		t.Errorf("Conflict condition not cleared: %v", mesh.Status.Conditions)
+	}
+}
+
+func TestReconcileChildDrift(t *testing.T) {
+	ctx := context.Background()
+	mesh := newTestMesh()
+	mesh.Status.ObservedGeneration = mesh.Generation
+	r := newTestReconciler(t, mesh)
+	events := r.Recorder.(*record.FakeRecorder).Events
+	key := types.NamespacedName{Name: render.Frontend, Namespace: mesh.Namespace}
+
+	apply := func(image string) string {
+		t.Helper()
+		for len(events) > 0 {
+			<-events
+		}
+		deployment := render.Deployment(mesh.Namespace, render.Frontend, v1beta1.ComponentSpec{ComponentTemplate: v1beta1.ComponentTemplate{Image: image}}, nil)
+		if _, err := r.reconcileChild(ctx, ctrl.Log, mesh, render.Frontend, deployment); err != nil {
+			t.Fatalf("reconcileChild: %v", err)
+		}
+		if len(events) == 0 {
+			return ""
+		}
+		return strings.Fields(<-events)[1]
+	}
+
+	apply("frontend:1.0")
+	// A change of the desired state, such as a newly resolved digest, is
+	// an update even though the Mesh is unchanged.
+	if reason := apply("frontend:1.0@sha256:0123"); reason != reasonUpdated {
+		t.Errorf("changed desired state: got %q, want %s", reason, reasonUpdated)
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, key, deployment); err != nil {
+		t.Fatal(err)
+	}
+	deployment.Spec.Template.Spec.Containers[0].Image = "frontend:edited"
+	if err := r.Client.Update(ctx, deployment); err != nil {
+		t.Fatal(err)
+	}
+	if reason := apply("frontend:1.0@sha256:0123"); reason != reasonDriftCorrected {
+		t.Errorf("external change: got %q, want %s", reason, reasonDriftCorrected)
+	}
+	if reason := apply("frontend:1.0@sha256:0123"); reason != "" {
+		t.Errorf("unchanged pass: got %q, want no event", reason)
+	}
+}
+
+func TestReconcileResume(t *testing.T) {
+	ctx := context.Background()
+	mesh := newTestMesh()
+	mesh.Spec.Components.Backend.Paused = true
+	r := newTestReconciler(t, mesh)
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	// Fail the applies of the backend, and record whether they are forced.
+	failing, forced := true, false
+	r.Client = interceptor.NewClient(r.Client.(client.WithWatch), interceptor.Funcs{
+		Patch: func(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+			if strings.HasPrefix(obj.GetName(), render.Backend) {
+				patchOpts := &client.PatchOptions{}
+				patchOpts.ApplyOptions(opts)
+				forced = patchOpts.Force != nil && *patchOpts.Force
+				if failing {
+					return errors.NewServiceUnavailable("apply failed")
+				}
+			}
+			return c.Patch(ctx, obj, patch, opts...)
+		},
+	})
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	mesh.Spec.Components.Backend.Paused = false
+	if err := r.Client.Update(ctx, mesh); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, failing = range []bool{true, false} {
+		forced = false
+		_, err := r.Reconcile(ctx, request)
+		if (err != nil) != failing {
+			t.Fatalf("Reconcile with failing applies %v: %v", failing, err)
+		}
+		if !forced {
+			t.Errorf("apply after resume was not forced")
+		}
+		if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+			t.Fatal(err)
+		}
+		if paused := mesh.Status.Components[1].Paused; paused != failing {
+			t.Errorf("backend paused in status after an apply that failed %v: got %v", failing, paused)
+		}
+	}
+}
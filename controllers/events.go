@@ -0,0 +1,119 @@
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+// Reasons used for the Events emitted on a Mesh. Failure reasons are also used
+// as the reason of a failed component in MeshStatus and as the reason label of
+// mesh_reconcile_errors_total.
+const (
+	reasonCreated                     = "Created"
+	reasonUpdated                     = "Updated"
+	reasonDriftCorrected              = "DriftCorrected"
+	reasonRolloutStarted              = "RolloutStarted"
+	reasonRolloutCompleted            = "RolloutCompleted"
+	reasonRolloutFailed               = "RolloutFailed"
+	reasonSecretMissing               = "SecretMissing"
+	reasonSecretGenerated             = "SecretGenerated"
+	reasonSecretRotated               = "SecretRotated"
+	reasonSecretsRestart              = "SecretsRestart"
+	reasonSecretGenerationFailed      = "SecretGenerationFailed"
+	reasonSecretFetchFailed           = "SecretFetchFailed"
+	reasonPolicyViolation             = "PolicyViolation"
+	reasonPolicyEvaluationFailed      = "PolicyEvaluationFailed"
+	reasonPruned                      = "Pruned"
+	reasonPaused                      = "Paused"
+	reasonResumed                     = "Resumed"
+	reasonCreateFailed                = "CreateFailed"
+	reasonUpdateFailed                = "UpdateFailed"
+	reasonApplyConflict               = "ApplyConflict"
+	reasonGetFailed                   = "GetFailed"
+	reasonTemplateFailed              = "TemplateFailed"
+	reasonImageRejected               = "ImageRejected"
+	reasonImageResolveFailed          = "ImageResolveFailed"
+	reasonImageUpdated                = "ImageUpdated"
+	reasonImageUpdateFailed           = "ImageUpdateFailed"
+	reasonSignatureVerificationFailed = "SignatureVerificationFailed"
+	reasonRenderFailed                = "RenderFailed"
+	reasonPruneFailed                 = "PruneFailed"
+	reasonStatusUpdateFailed          = "StatusUpdateFailed"
+	reasonReconcileFailed             = "ReconcileFailed"
+)
+
+// recordRolloutEvents emits an Event for every component whose rollout
+// started, completed or failed between previous and status.
+func (r *MeshReconciler) recordRolloutEvents(instance *v1beta1.Mesh, previous, status v1beta1.MeshStatus) {
+	for _, component := range status.Components {
+		var before v1beta1.MeshPhase
+		for _, old := range previous.Components {
+			if old.Name == component.Name {
+				before = old.Phase
+			}
+		}
+		if before == component.Phase {
+			continue
+		}
+
+		switch component.Phase {
+		case v1beta1.MeshPhaseProgressing:
+			r.Recorder.Eventf(instance, corev1.EventTypeNormal, reasonRolloutStarted,
+				"Rollout of %s started with image %s", component.Name, component.Image)
+		case v1beta1.MeshPhaseReady:
+			if before == v1beta1.MeshPhaseProgressing {
+				r.Recorder.Eventf(instance, corev1.EventTypeNormal, reasonRolloutCompleted,
+					"Rollout of %s completed: %d/%d replicas available", component.Name, component.AvailableReplicas, component.DesiredReplicas)
+			}
+		case v1beta1.MeshPhaseFailed:
+			// Reconcile failures already produced an Event of their own.
+			switch component.Reason {
+			case reasonCreateFailed, reasonUpdateFailed, reasonApplyConflict, reasonGetFailed, reasonRenderFailed, reasonPruneFailed,
+				reasonImageRejected, reasonImageResolveFailed, reasonSignatureVerificationFailed, reasonSecretGenerationFailed,
+				reasonSecretFetchFailed, reasonPolicyViolation, reasonPolicyEvaluationFailed:
+			default:
+				r.Recorder.Eventf(instance, corev1.EventTypeWarning, reasonRolloutFailed,
+					"Rollout of %s failed: %s: %s", component.Name, component.Reason, component.Message)
+			}
+		}
+	}
+}
+
+// recordPauseEvents emits an Event for every component that was paused or
+// resumed between previous and status.
+func (r *MeshReconciler) recordPauseEvents(instance *v1beta1.Mesh, previous, status v1beta1.MeshStatus) {
+	for _, component := range status.Components {
+		var before bool
+		for _, old := range previous.Components {
+			if old.Name == component.Name {
+				before = old.Paused
+			}
+		}
+		switch {
+		case component.Paused && !before:
+			r.Recorder.Eventf(instance, corev1.EventTypeNormal, reasonPaused, "Paused reconciliation of %s", component.Name)
+		case !component.Paused && before:
+			r.Recorder.Eventf(instance, corev1.EventTypeNormal, reasonResumed, "Resumed reconciliation of %s", component.Name)
+		}
+	}
+}
+
+// recordSecretEvents emits an Event for every component whose Deployment
+// started to reference a missing Secret between previous and status.
+func (r *MeshReconciler) recordSecretEvents(instance *v1beta1.Mesh, previous, status v1beta1.MeshStatus) {
+	for _, component := range status.Components {
+		if component.Reason != reasonSecretMissing {
+			continue
+		}
+		var before string
+		for _, old := range previous.Components {
+			if old.Name == component.Name {
+				before = old.Reason
+			}
+		}
+		if before != reasonSecretMissing {
+			r.Recorder.Event(instance, corev1.EventTypeWarning, reasonSecretMissing, component.Message)
+		}
+	}
+}
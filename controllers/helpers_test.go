@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+// newTestMesh returns a Mesh named mesh-sample in the default namespace.
+func newTestMesh() *v1beta1.Mesh {
+	return &v1beta1.Mesh{
+		ObjectMeta: metav1.ObjectMeta{Name: "mesh-sample", Namespace: "default", Generation: 1},
+		Spec: v1beta1.MeshSpec{
+			Replicas: 1,
+			Components: v1beta1.MeshComponents{
+				Frontend: v1beta1.ComponentSpec{ComponentTemplate: v1beta1.ComponentTemplate{Image: "frontend:1.0"}},
+				Backend:  v1beta1.ComponentSpec{ComponentTemplate: v1beta1.ComponentTemplate{Image: "backend:1.0"}},
+				App:      v1beta1.ComponentSpec{ComponentTemplate: v1beta1.ComponentTemplate{Image: "app:1.0"}},
+			},
+		},
+	}
+}
+
+// newTestReconciler returns a MeshReconciler backed by a fake client that
+// holds objs.
+func newTestReconciler(t *testing.T, objs ...client.Object) *MeshReconciler {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := v1beta1.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(objs...).
+		WithStatusSubresource(&v1beta1.Mesh{}).
+		WithIndex(&v1beta1.Mesh{}, templateIndex, indexTemplate).
+		WithIndex(&v1beta1.Mesh{}, referencedSecretsIndex, indexReferencedSecrets).
+		WithInterceptorFuncs(interceptor.Funcs{Patch: applyPatch}).
+		Build()
+	return &MeshReconciler{
+		Client:   c,
+		Log:      ctrl.Log,
+		Scheme:   scheme,
+		Recorder: record.NewFakeRecorder(100),
+	}
+}
+
+// applyPatch stands in for server-side apply, which the fake client only
+// handles as a strategic merge patch of an existing object. It creates
+// missing objects and, like the API server, leaves the resource version alone
+// when the patch changes nothing. Field ownership is not tracked.
+func applyPatch(ctx context.Context, c client.WithWatch, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Patch(ctx, obj, patch, opts...)
+	}
+
+	current := obj.DeepCopyObject().(client.Object)
+	err := c.Get(ctx, client.ObjectKeyFromObject(obj), current)
+	if errors.IsNotFound(err) {
+		return c.Create(ctx, obj)
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return err
+	}
+	// Rendered objects are unstructured; merge them with the schema of their
+	// typed equivalent.
+	var dataStruct runtime.Object = current
+	if _, ok := current.(*unstructured.Unstructured); ok {
+		if dataStruct, err = c.Scheme().New(current.GetObjectKind().GroupVersionKind()); err != nil {
+			return err
+		}
+	}
+	merged, err := strategicpatch.StrategicMergePatch(currentJSON, data, dataStruct)
+	if err != nil {
+		return err
+	}
+	updated := reflect.New(reflect.TypeOf(obj).Elem()).Interface().(client.Object)
+	if err := json.Unmarshal(merged, updated); err != nil {
+		return err
+	}
+	updated.GetObjectKind().SetGroupVersionKind(current.GetObjectKind().GroupVersionKind())
+
+	if !equality.Semantic.DeepEqual(current, updated) {
+		if err := c.Update(ctx, updated); err != nil {
+			return err
+		}
+		current = updated
+	}
+	reflect.ValueOf(obj).Elem().Set(reflect.ValueOf(current).Elem())
+	return nil
+}
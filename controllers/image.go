@@ -0,0 +1,177 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	logr "github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+// resolveImage applies the image policy of instance to the image of a
+// component and returns the image to deploy. When the operator has signature
+// keys, the image must be signed with one of them whatever the policy, and is
+// deployed by the digest that was verified.
+func (r *MeshReconciler) resolveImage(ctx context.Context, instance *v1beta1.Mesh, component, image string) (string, error) {
+	policy := instance.Spec.ImagePolicy
+	if policy == nil {
+		policy = &v1beta1.ImagePolicy{}
+	}
+	verify := len(r.SignatureKeys) > 0
+	if !policy.PinDigests && !policy.RejectMutableTags && !verify {
+		return image, nil
+	}
+
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		return "", &componentError{component, reasonImageRejected, err}
+	}
+	digest, pinned := ref.(name.Digest)
+	if !pinned && policy.RejectMutableTags {
+		return "", &componentError{component, reasonImageRejected,
+			fmt.Errorf("image %s is not referenced by digest", image)}
+	}
+	if pinned && !verify {
+		return image, nil
+	}
+
+	keychain, err := r.pullSecretKeychain(ctx, instance.Namespace, policy.ImagePullSecrets)
+	if err != nil {
+		return "", &componentError{component, reasonImageResolveFailed, err}
+	}
+	options := []remote.Option{remote.WithContext(ctx), remote.WithAuthFromKeychain(keychain)}
+	if !pinned {
+		descriptor, err := remote.Head(ref, options...)
+		if err != nil {
+			return "", &componentError{component, reasonImageResolveFailed,
+				fmt.Errorf("resolving image %s: %w", image, err)}
+		}
+		image += "@" + descriptor.Digest.String()
+		digest = ref.Context().Digest(descriptor.Digest.String())
+	}
+
+	if verify {
+		if err := verifySignature(digest, r.SignatureKeys, options...); err != nil {
+			return "", &componentError{component, reasonSignatureVerificationFailed, err}
+		}
+	}
+	return image, nil
+}
+
+// resolveSourceImages resolves the images of the containers of the
+// Deployments rendered from the source of component as resolveImage does for
+// built-in components, replacing them with the images to deploy.
+func (r *MeshReconciler) resolveSourceImages(ctx context.Context, log logr.Logger, instance *v1beta1.Mesh, component string, objects []*unstructured.Unstructured) error {
+	for _, obj := range objects {
+		if obj.GroupVersionKind().GroupKind() != (schema.GroupKind{Group: "apps", Kind: "Deployment"}) {
+			continue
+		}
+		for _, field := range []string{"initContainers", "containers"} {
+			containers, found, err := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", field)
+			if err != nil {
+				return &componentError{component, reasonRenderFailed, fmt.Errorf("Deployment %s: %w", obj.GetName(), err)}
+			}
+			if !found {
+				continue
+			}
+			for _, c := range containers {
+				container, ok := c.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				image, _ := container["image"].(string)
+				if image == "" {
+					continue
+				}
+				resolved, err := r.resolveImage(ctx, instance, component, image)
+				if err != nil {
+					log.Error(err, "Failed to resolve image", "component", component, "Deployment.Name", obj.GetName(), "image", image)
+					return err
+				}
+				container["image"] = resolved
+			}
+			if err := unstructured.SetNestedSlice(obj.Object, containers, "spec", "template", "spec", field); err != nil {
+				return &componentError{component, reasonRenderFailed, err}
+			}
+		}
+	}
+	return nil
+}
+
+// imageDigest returns the digest an image is referenced by, if any.
+func imageDigest(image string) string {
+	if i := strings.LastIndex(image, "@"); i >= 0 {
+		return image[i+1:]
+	}
+	return ""
+}
+
+// pullSecretKeychain reads the registry credentials of the docker config
+// Secrets referenced by secrets.
+func (r *MeshReconciler) pullSecretKeychain(ctx context.Context, namespace string, secrets []corev1.LocalObjectReference) (authn.Keychain, error) {
+	keychain := pullSecretKeychain{}
+	for _, ref := range secrets {
+		secret := &corev1.Secret{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: namespace}, secret); err != nil {
+			return nil, fmt.Errorf("image pull secret %s: %w", ref.Name, err)
+		}
+
+		var auths map[string]authn.AuthConfig
+		var err error
+		switch secret.Type {
+		case corev1.SecretTypeDockerConfigJson:
+			var config struct {
+				Auths map[string]authn.AuthConfig `json:"auths"`
+			}
+			err = json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config)
+			auths = config.Auths
+		case corev1.SecretTypeDockercfg:
+			err = json.Unmarshal(secret.Data[corev1.DockerConfigKey], &auths)
+		default:
+			err = fmt.Errorf("unsupported type %s", secret.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("image pull secret %s: %w", ref.Name, err)
+		}
+
+		for server, auth := range auths {
+			host := registryHost(server)
+			if _, ok := keychain[host]; !ok {
+				keychain[host] = auth
+			}
+		}
+	}
+	return keychain, nil
+}
+
+// registryHost returns the host of a docker config server entry, which may be
+// a URL such as https://index.docker.io/v1/.
+func registryHost(server string) string {
+	server = strings.TrimPrefix(strings.TrimPrefix(server, "https://"), "http://")
+	host, _, _ := strings.Cut(server, "/")
+	if host == "docker.io" {
+		return name.DefaultRegistry
+	}
+	return host
+}
+
+// pullSecretKeychain holds registry credentials by registry host. The first
+// Secret holding credentials for a registry wins, as for the kubelet.
+type pullSecretKeychain map[string]authn.AuthConfig
+
+func (k pullSecretKeychain) Resolve(target authn.Resource) (authn.Authenticator, error) {
+	if auth, ok := k[target.RegistryStr()]; ok {
+		return authn.FromConfig(auth), nil
+	}
+	return authn.Anonymous, nil
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+// newTestRegistry starts an in-process registry that requires basic auth as
+// user:secret and pushes a random image for every component of a Mesh,
+// tagged 1.0. It returns the host of the registry and the image digests by
+// component.
+func newTestRegistry(t *testing.T) (string, map[string]string) {
+	t.Helper()
+	handler := registry.New()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if user, password, ok := req.BasicAuth(); !ok || user != "user" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	}))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	digests := map[string]string{}
+	auth := remote.WithAuth(&authn.Basic{Username: "user", Password: "secret"})
+	for _, component := range render.ComponentNames {
+		image, err := random.Image(256, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ref, err := name.ParseReference(host + "/" + component + ":1.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.Write(ref, image, auth); err != nil {
+			t.Fatal(err)
+		}
+		digest, err := image.Digest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		digests[component] = digest.String()
+	}
+	return host, digests
+}
+
+func TestReconcilePinDigests(t *testing.T) {
+	ctx := context.Background()
+	host, digests := newTestRegistry(t)
+
+	mesh := newTestMesh()
+	mesh.Spec.Components.Frontend.Image = host + "/frontend:1.0"
+	mesh.Spec.Components.Backend.Image = host + "/backend:1.0"
+	mesh.Spec.Components.App.Image = host + "/app:1.0"
+	mesh.Spec.ImagePolicy = &v1beta1.ImagePolicy{
+		PinDigests:       true,
+		ImagePullSecrets: []corev1.LocalObjectReference{{Name: "registry"}},
+	}
+	pullSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: mesh.Namespace},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{corev1.DockerConfigJsonKey: []byte(`{"auths":{"http://` + host + `/v2/":{"auth":"` +
+			base64.StdEncoding.EncodeToString([]byte("user:secret")) + `"}}}`)},
+	}
+	r := newTestReconciler(t, mesh, pullSecret)
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}}
+
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	deployment := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: render.Backend, Namespace: mesh.Namespace}, deployment); err != nil {
+		t.Fatal(err)
+	}
+	pod := deployment.Spec.Template.Spec
+	if want := host + "/backend:1.0@" + digests[render.Backend]; pod.Containers[0].Image != want {
+		t.Errorf("image: got %s, want %s", pod.Containers[0].Image, want)
+	}
+	if len(pod.ImagePullSecrets) != 1 || pod.ImagePullSecrets[0].Name != "registry" {
+		t.Errorf("image pull secrets: got %v", pod.ImagePullSecrets)
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	for _, component := range mesh.Status.Components {
+		if component.ImageDigest != digests[component.Name] {
+			t.Errorf("%s: status digest %q, want %q", component.Name, component.ImageDigest, digests[component.Name])
+		}
+	}
+
+	// Without credentials the tag cannot be resolved.
+	mesh.Spec.ImagePolicy.ImagePullSecrets = nil
+	if _, err := r.resolveImage(ctx, mesh, render.Backend, host+"/backend:1.0"); errorReason(err) != reasonImageResolveFailed {
+		t.Errorf("resolving without credentials: got %v, want %s", err, reasonImageResolveFailed)
+	}
+}
+
+func TestReconcileRejectMutableTags(t *testing.T) {
+	ctx := context.Background()
+	mesh := newTestMesh()
+	mesh.Spec.Components.Frontend.Image = "frontend@sha256:" + strings.Repeat("a", 64)
+	mesh.Spec.ImagePolicy = &v1beta1.ImagePolicy{RejectMutableTags: true}
+	r := newTestReconciler(t, mesh)
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}}
+
+	if _, err := r.Reconcile(ctx, request); err == nil {
+		t.Fatalf("Reconcile succeeded with images referenced by tag")
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	for _, component := range mesh.Status.Components {
+		switch {
+		case component.Name == render.Frontend && component.ImageDigest != "sha256:"+strings.Repeat("a", 64):
+			t.Errorf("frontend referenced by digest was not applied: %+v", component)
+		case component.Name != render.Frontend && component.Reason != reasonImageRejected:
+			t.Errorf("%s: reason %q, want %s", component.Name, component.Reason, reasonImageRejected)
+		}
+	}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: render.Backend, Namespace: mesh.Namespace}, &appsv1.Deployment{}); err == nil {
+		t.Errorf("Deployment was created for an image referenced by tag")
+	}
+}
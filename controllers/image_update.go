@@ -0,0 +1,300 @@
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	logr "github.com/go-logr/logr"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+// imageCheck is the outcome of checking the repository of a component for a
+// newer image.
+type imageCheck struct {
+	// pending is the newer image awaiting approval, or "" if there is none.
+	pending string
+	// at is when the repository was listed.
+	at metav1.Time
+}
+
+// updateImages checks the repository of every component with an image update
+// policy for newer tags. Components that do not require approval are moved
+// to the newest tag right away, both in instance and in the stored Mesh. The
+// outcome of every component checked is returned by component. A failed
+// check is reported, but does not fail the component.
+//
+// A repository is listed at most once per ImageUpdateInterval, or only once
+// if the interval is zero, unless force is set, as when a push to it was
+// notified, or the spec of the Mesh changed since it was last reconciled.
+func (r *MeshReconciler) updateImages(ctx context.Context, log logr.Logger, instance *v1beta1.Mesh, force bool) map[string]imageCheck {
+	force = force || instance.Generation != instance.Status.ObservedGeneration
+	checks := map[string]imageCheck{}
+	now := metav1.Now()
+	for _, name := range render.ComponentNames {
+		spec := render.ComponentSpecRef(instance, name)
+		if spec.ImageUpdate == nil || spec.Paused || spec.Source != nil {
+			continue
+		}
+		if last := previousImageCheck(instance, name); !force && last != nil &&
+			(r.ImageUpdateInterval == 0 || now.Before(&metav1.Time{Time: last.Add(r.ImageUpdateInterval)})) {
+			continue
+		}
+
+		image, err := r.newerImage(ctx, instance, spec)
+		if err == nil && image != "" && !spec.ImageUpdate.RequireApproval {
+			err = r.setImage(ctx, instance, name, image)
+			if err == nil {
+				log.Info("Updated image", "component", name, "from", spec.Image, "to", image)
+				r.Recorder.Eventf(instance, corev1.EventTypeNormal, reasonImageUpdated,
+					"Updated image of %s from %s to %s", name, spec.Image, image)
+				spec.Image = image
+				image = ""
+			}
+		}
+		if err != nil {
+			log.Error(err, "Failed to update image", "component", name)
+			reconcileErrors.WithLabelValues(reasonImageUpdateFailed).Inc()
+			r.Recorder.Eventf(instance, corev1.EventTypeWarning, reasonImageUpdateFailed,
+				"Failed to update image of %s: %v", name, err)
+			// Keep the pending image, but wait for the interval before
+			// listing the repository again.
+			checks[name] = imageCheck{pending: previousPendingImage(instance, name), at: now}
+			continue
+		}
+		checks[name] = imageCheck{pending: image, at: now}
+	}
+	return checks
+}
+
+// previousImageCheck returns when the repository of component was last
+// listed, or nil if it never was.
+func previousImageCheck(instance *v1beta1.Mesh, component string) *metav1.Time {
+	for _, status := range instance.Status.Components {
+		if status.Name == component {
+			return status.LastImageCheck
+		}
+	}
+	return nil
+}
+
+// newerImage returns the component's image with the highest tag allowed by
+// its image update policy, or "" if that is not newer than the current tag.
+// A current tag that is not a semantic version is always replaced.
+func (r *MeshReconciler) newerImage(ctx context.Context, instance *v1beta1.Mesh, spec *v1beta1.ComponentSpec) (string, error) {
+	constraint, err := semver.NewConstraint(spec.ImageUpdate.Semver)
+	if err != nil {
+		return "", fmt.Errorf("semver constraint %q: %w", spec.ImageUpdate.Semver, err)
+	}
+	image, _, _ := strings.Cut(spec.Image, "@")
+	tag, err := name.NewTag(image)
+	if err != nil {
+		return "", err
+	}
+
+	var secrets []corev1.LocalObjectReference
+	if instance.Spec.ImagePolicy != nil {
+		secrets = instance.Spec.ImagePolicy.ImagePullSecrets
+	}
+	keychain, err := r.pullSecretKeychain(ctx, instance.Namespace, secrets)
+	if err != nil {
+		return "", err
+	}
+	tags, err := remote.List(tag.Context(), remote.WithContext(ctx), remote.WithAuthFromKeychain(keychain))
+	if err != nil {
+		return "", fmt.Errorf("listing tags of %s: %w", tag.Context(), err)
+	}
+
+	var newest *semver.Version
+	var newestTag string
+	for _, candidate := range tags {
+		version, err := semver.NewVersion(candidate)
+		if err != nil || !constraint.Check(version) {
+			continue
+		}
+		if newest == nil || version.GreaterThan(newest) {
+			newest, newestTag = version, candidate
+		}
+	}
+	if newest == nil {
+		return "", nil
+	}
+	if current, err := semver.NewVersion(tag.TagStr()); err == nil && !newest.GreaterThan(current) {
+		return "", nil
+	}
+	return strings.TrimSuffix(image, ":"+tag.TagStr()) + ":" + newestTag, nil
+}
+
+// setImage sets the image of a component in the stored Mesh. Only the image
+// is patched, so that settings instance took from its MeshTemplate are not
+// written back. instance takes the new resource version and generation, as
+// the rest of the reconcile applies the new image.
+func (r *MeshReconciler) setImage(ctx context.Context, instance *v1beta1.Mesh, component, image string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"components": map[string]interface{}{
+				component: map[string]interface{}{"image": image},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	mesh := &v1beta1.Mesh{}
+	mesh.Name, mesh.Namespace = instance.Name, instance.Namespace
+	if err := r.Client.Patch(ctx, mesh, client.RawPatch(types.MergePatchType, patch)); err != nil {
+		return err
+	}
+	instance.ResourceVersion = mesh.ResourceVersion
+	instance.Generation = mesh.Generation
+	return nil
+}
+
+// hasImageUpdates reports whether any component of instance has an image
+// update policy.
+func hasImageUpdates(instance *v1beta1.Mesh) bool {
+	for _, name := range render.ComponentNames {
+		if render.ComponentSpec(instance, name).ImageUpdate != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ImageWebhook receives push notifications from a container registry, in the
+// format of the CNCF distribution registry, and sends an event for every Mesh
+// with an image update policy on a component whose repository was pushed to.
+// The MeshReconciler watches the events through its ImageEvents, so that new
+// tags are picked up without waiting for the next poll: the reconcile an
+// event triggers lists the repositories of the Mesh right away. Only
+// notifications that carry Token as a bearer token are accepted.
+type ImageWebhook struct {
+	Client client.Client
+	Log    logr.Logger
+
+	// Addr is the address the webhook is served on.
+	Addr string
+
+	// Token is the shared secret the registry sends in the Authorization
+	// header of its notifications, as "Bearer <token>".
+	Token string
+
+	events chan event.GenericEvent
+}
+
+// NewImageWebhook returns an ImageWebhook served on addr that finds Meshes
+// with c and accepts notifications authenticated with token.
+func NewImageWebhook(c client.Client, log logr.Logger, addr, token string) *ImageWebhook {
+	return &ImageWebhook{Client: c, Log: log, Addr: addr, Token: token, events: make(chan event.GenericEvent, 1024)}
+}
+
+// Events returns the channel the webhook sends events on.
+func (w *ImageWebhook) Events() <-chan event.GenericEvent {
+	return w.events
+}
+
+// registryNotification is the envelope of distribution registry notifications.
+type registryNotification struct {
+	Events []struct {
+		Action string `json:"action"`
+		Target struct {
+			Repository string `json:"repository"`
+		} `json:"target"`
+		Request struct {
+			Host string `json:"host"`
+		} `json:"request"`
+	} `json:"events"`
+}
+
+func (w *ImageWebhook) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(rw, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	// An empty token authenticates nothing, rather than everything.
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || w.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(w.Token)) != 1 {
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var notification registryNotification
+	if err := json.NewDecoder(req.Body).Decode(&notification); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pushed := map[string]bool{}
+	for _, e := range notification.Events {
+		if e.Action != "push" {
+			continue
+		}
+		repository, err := name.NewRepository(e.Request.Host + "/" + e.Target.Repository)
+		if err != nil {
+			continue
+		}
+		pushed[repository.Name()] = true
+	}
+	if len(pushed) == 0 {
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+
+	meshes := &v1beta1.MeshList{}
+	if err := w.Client.List(req.Context(), meshes); err != nil {
+		w.Log.Error(err, "Failed to list Meshes")
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range meshes.Items {
+		mesh := &meshes.Items[i]
+		for _, component := range render.ComponentNames {
+			spec := render.ComponentSpec(mesh, component)
+			image, _, _ := strings.Cut(spec.Image, "@")
+			tag, err := name.NewTag(image)
+			if spec.ImageUpdate == nil || err != nil || !pushed[tag.Context().Name()] {
+				continue
+			}
+			select {
+			case w.events <- event.GenericEvent{Object: mesh}:
+			default:
+				// The Mesh is still polled; dropping the event only delays its update.
+				w.Log.Info("Image event queue is full. Dropping event", "mesh", client.ObjectKeyFromObject(mesh))
+			}
+			break
+		}
+	}
+	rw.WriteHeader(http.StatusOK)
+}
+
+// Start serves the webhook until ctx is done.
+func (w *ImageWebhook) Start(ctx context.Context) error {
+	server := &http.Server{Addr: w.Addr, Handler: w, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NeedLeaderElection lets every replica serve the webhook, so that a
+// Service in front of them can route to any of them.
+func (w *ImageWebhook) NeedLeaderElection() bool {
+	return false
+}
@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/random"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+// pushTags pushes a random image to repository on host with every tag.
+func pushTags(t *testing.T, host, repository string, tags ...string) {
+	t.Helper()
+	image, err := random.Image(256, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range tags {
+		ref, err := name.NewTag(host + "/" + repository + ":" + tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := remote.Write(ref, image); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestReconcileImageUpdate(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	pushTags(t, host, "backend", "1.4.0", "1.4.2", "1.5.0", "latest")
+
+	mesh := newTestMesh()
+	mesh.Spec.Components.Backend.Image = host + "/backend:1.4.0"
+	mesh.Spec.Components.Backend.ImageUpdate = &v1beta1.ImageUpdatePolicy{Semver: "~1.4"}
+	r := newTestReconciler(t, mesh)
+	r.ImageUpdateInterval = time.Minute
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}}
+
+	result, err := r.Reconcile(ctx, request)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if result.RequeueAfter != time.Minute {
+		t.Errorf("RequeueAfter: got %v, want the image update interval", result.RequeueAfter)
+	}
+	want := host + "/backend:1.4.2"
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if mesh.Spec.Components.Backend.Image != want {
+		t.Errorf("Mesh image: got %s, want %s", mesh.Spec.Components.Backend.Image, want)
+	}
+	if mesh.Status.ObservedGeneration != mesh.Generation {
+		t.Errorf("observed generation %d, want %d", mesh.Status.ObservedGeneration, mesh.Generation)
+	}
+	deployment := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: render.Backend, Namespace: mesh.Namespace}, deployment); err != nil {
+		t.Fatal(err)
+	}
+	if image := deployment.Spec.Template.Spec.Containers[0].Image; image != want {
+		t.Errorf("Deployment image: got %s, want %s", image, want)
+	}
+	if mesh.Status.Components[1].LastImageCheck == nil {
+		t.Fatalf("last image check of backend not recorded")
+	}
+
+	// The repository is not listed again before the interval has passed,
+	// unless a push to it was notified.
+	pushTags(t, host, "backend", "1.4.3")
+	for _, tc := range []struct {
+		pushed bool
+		want   string
+	}{
+		{false, host + "/backend:1.4.2"},
+		{true, host + "/backend:1.4.3"},
+	} {
+		if tc.pushed {
+			r.imagePushes.Store(request.NamespacedName, true)
+		}
+		if _, err := r.Reconcile(ctx, request); err != nil {
+			t.Fatalf("Reconcile: %v", err)
+		}
+		if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+			t.Fatal(err)
+		}
+		if mesh.Spec.Components.Backend.Image != tc.want {
+			t.Errorf("pushed %v: got image %s, want %s", tc.pushed, mesh.Spec.Components.Backend.Image, tc.want)
+		}
+	}
+
+	pushTags(t, host, "backend", "1.4.4")
+	mesh.Status.Components[1].LastImageCheck = &metav1.Time{Time: time.Now().Add(-2 * time.Minute)}
+	if err := r.Client.Status().Update(ctx, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if want := host + "/backend:1.4.4"; mesh.Spec.Components.Backend.Image != want {
+		t.Errorf("after the interval: got image %s, want %s", mesh.Spec.Components.Backend.Image, want)
+	}
+}
+
+func TestReconcileImageUpdateApproval(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+	pushTags(t, host, "backend", "1.4.0", "1.4.2")
+
+	mesh := newTestMesh()
+	mesh.Spec.Components.Backend.Image = host + "/backend:1.4.0"
+	mesh.Spec.Components.Backend.ImageUpdate = &v1beta1.ImageUpdatePolicy{Semver: "~1.4", RequireApproval: true}
+	r := newTestReconciler(t, mesh)
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}}
+
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	want := host + "/backend:1.4.2"
+	if mesh.Spec.Components.Backend.Image != host+"/backend:1.4.0" {
+		t.Errorf("image was updated without approval: %s", mesh.Spec.Components.Backend.Image)
+	}
+	if pending := mesh.Status.Components[1].PendingImage; pending != want {
+		t.Errorf("pending image: got %q, want %s", pending, want)
+	}
+
+	mesh.Spec.Components.Backend.Image = want
+	if err := r.Client.Update(ctx, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if pending := mesh.Status.Components[1].PendingImage; pending != "" {
+		t.Errorf("pending image after approval: got %q, want none", pending)
+	}
+}
+
+func TestImageWebhook(t *testing.T) {
+	mesh := newTestMesh()
+	mesh.Spec.Components.Backend.Image = "registry.example.com/team/backend:1.4.0"
+	mesh.Spec.Components.Backend.ImageUpdate = &v1beta1.ImageUpdatePolicy{Semver: "~1.4"}
+	other := newTestMesh()
+	other.Name = "other"
+	r := newTestReconciler(t, mesh, other)
+	webhook := NewImageWebhook(r.Client, r.Log, "", "s3cret")
+	push := func(repository, authorization string) int {
+		body := `{"events":[{"action":"push","target":{"repository":"` + repository + `","tag":"1.4.3"},"request":{"host":"registry.example.com"}}]}`
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		recorder := httptest.NewRecorder()
+		webhook.ServeHTTP(recorder, req)
+		return recorder.Code
+	}
+
+	for _, authorization := range []string{"", "Bearer wrong", "s3cret"} {
+		if code := push("team/backend", authorization); code != http.StatusUnauthorized {
+			t.Errorf("authorization %q: got status %d, want %d", authorization, code, http.StatusUnauthorized)
+		}
+	}
+	if len(webhook.Events()) > 0 {
+		t.Fatalf("unauthenticated notifications sent events")
+	}
+
+	for _, tc := range []struct {
+		repository string
+		want       bool
+	}{
+		{"team/backend", true},
+		{"team/frontend", false},
+	} {
+		if code := push(tc.repository, "Bearer s3cret"); code != http.StatusOK {
+			t.Fatalf("%s: status %d", tc.repository, code)
+		}
+
+		select {
+		case e := <-webhook.Events():
+			if !tc.want || e.Object.GetName() != mesh.Name {
+				t.Errorf("%s: unexpected event for %s", tc.repository, e.Object.GetName())
+			}
+		default:
+			if tc.want {
+				t.Errorf("%s: no event for the Mesh", tc.repository)
+			}
+		}
+	}
+}
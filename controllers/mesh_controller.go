@@ -2,552 +2,347 @@ package controllers
 
 import (
 	"context"
+	"crypto"
+	"fmt"
+	"sync"
+	"time"
+
 	logr "github.com/go-logr/logr"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	// "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	// meshcomv1alpha1 "github.com/vilayilarun/pkg/api/v1alpha1"
-	v1alpha1 "github.com/vilayilarun/pkg/api/v1alpha1"
-)
-
-const (
-	frontendName = "frontend"
-	backendName  = "backend"
-	appName      = "app"
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
 )
 
 // MeshReconciler reconciles a Mesh object
 type MeshReconciler struct {
-	client client.Client
-	Log    logr.Logger
-	Scheme *runtime.Scheme
-}
-
-func (r *MeshReconciler) createConfigMap(ctx context.Context, instance *v1alpha1.Mesh, name, label string, data map[string]string) error {
-	configMap := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: instance.Namespace,
-			Labels: map[string]string{
-				"app": label,
-			},
-		},
-		Data: data,
-	}
-
-	if err := ctrl.SetControllerReference(instance, configMap, r.client.Scheme()); err != nil {
-		return err
-	}
-
-	foundConfigMap := &corev1.ConfigMap{}
-	err := r.client.Get(ctx, types.NamespacedName{Name: name, Namespace: instance.Namespace}, foundConfigMap)
-	if err != nil && errors.IsNotFound(err) {
-		r.Log.Info("Creating a new ConfigMap", "ConfigMap.Namespace", configMap.Namespace, "ConfigMap.Name", configMap.Name)
-		err = r.client.Create(ctx, configMap)
-		if err != nil {
-			r.Log.Error(err, "Failed to create new ConfigMap", "ConfigMap.Namespace", configMap.Namespace, "ConfigMap.Name", configMap.Name)
-			return err
-		}
-	} else if err != nil {
-		r.Log.Error(err, "Failed to get ConfigMap", "ConfigMap.Namespace", configMap.Namespace, "ConfigMap.Name", configMap.Name)
-		return err
-	}
-
-	return nil
-}
-func (r *MeshReconciler) createSecret(ctx context.Context, instance *v1alpha1.Mesh, name, label string, data map[string]string) error {
-	secret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: instance.Namespace,
-			Labels: map[string]string{
-				"app": label,
-			},
-		},
-		StringData: data,
-	}
-
-	if err := ctrl.SetControllerReference(instance, secret, r.client.Scheme()); err != nil {
-		return err
-	}
-
-	foundSecret := &corev1.Secret{}
-	err := r.client.Get(ctx, types.NamespacedName{Name: name, Namespace: instance.Namespace}, foundSecret)
-	if err != nil && errors.IsNotFound(err) {
-		r.Log.Info("Creating a new Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
-		err = r.client.Create(ctx, secret)
-		if err != nil {
-			r.Log.Error(err, "Failed to create new Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
-			return err
-		}
-	} else if err != nil {
-		r.Log.Error(err, "Failed to get Secret", "Secret.Namespace", secret.Namespace, "Secret.Name", secret.Name)
-		return err
-	}
-
-	return nil
+	Client   client.Client
+	Log      logr.Logger
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+
+	// APIReader reads the Secrets holding generated values and the Mesh CA
+	// from the API server rather than the cache, so that a value missing
+	// from a stale cache is not generated anew. Client is used when nil.
+	APIReader client.Reader
+
+	// Tracer records a span for every reconcile. Tracing is disabled when nil.
+	Tracer trace.Tracer
+
+	// ForceOwnership makes the operator take over fields of child objects
+	// that another field manager owns instead of reporting a conflict.
+	ForceOwnership bool
+
+	// Shard limits the reconciler to the Meshes of one shard.
+	Shard Shard
+
+	// MaxConcurrentReconciles is the number of Meshes reconciled in
+	// parallel. Defaults to 1.
+	MaxConcurrentReconciles int
+
+	// RateLimiter delays the retries of failed reconciles. Defaults to the
+	// controller-runtime rate limiter.
+	RateLimiter ratelimiter.RateLimiter
+
+	// RequeueInterval is how often a Mesh is reconciled again to refresh its
+	// status when nothing else triggers it. Disabled when zero.
+	RequeueInterval time.Duration
+
+	// SourceDir is the directory the paths of component sources are
+	// relative to.
+	SourceDir string
+
+	// ImageUpdateInterval is how often the repositories of components with
+	// an image update policy are checked for newer tags. Disabled when zero.
+	ImageUpdateInterval time.Duration
+
+	// ImageEvents triggers a reconcile of the Meshes sent on it, such as by
+	// an ImageWebhook, which lists their repositories right away.
+	ImageEvents <-chan event.GenericEvent
+
+	// imagePushes holds the keys of the Meshes sent on ImageEvents that
+	// have not been reconciled since.
+	imagePushes sync.Map
+
+	// charts caches the charts of component sources pulled from OCI
+	// registries.
+	charts render.ChartCache
+
+	// SecretProviders are the secret stores external secrets are read from,
+	// by provider name. A kubernetes provider reading Secrets with Client is
+	// used unless one is registered under that name.
+	SecretProviders map[string]SecretProvider
+
+	// SecretRefreshInterval is how often external secrets are read again.
+	// Disabled when zero.
+	SecretRefreshInterval time.Duration
+
+	// Policy checks the child objects of every component before they are
+	// applied. Disabled when nil.
+	Policy *PolicyEngine
+
+	// SignatureKeys are the cosign public keys one of which the images of
+	// the components of every Mesh must be signed with. Verification is
+	// disabled when empty.
+	SignatureKeys []crypto.PublicKey
 }
 
-func (r *MeshReconciler) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+// The operator applies children with server-side apply, which creates them
+// with the patch verb but needs create as well, and deletes the children it
+// prunes. Roles can only grant what the operator holds itself, since it has
+// neither escalate nor bind.
+//+kubebuilder:rbac:groups=mesh.com,resources=meshes,verbs=get;list;watch;patch
+//+kubebuilder:rbac:groups=mesh.com,resources=meshes/status,verbs=update
+//+kubebuilder:rbac:groups=mesh.com,resources=meshes/finalizers,verbs=update
+//+kubebuilder:rbac:groups=mesh.com,resources=meshtemplates,verbs=get;list;watch
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;patch;delete
+//+kubebuilder:rbac:groups="",resources=configmaps;secrets;serviceaccounts;services,verbs=get;list;watch;create;patch;delete
+//+kubebuilder:rbac:groups=rbac.authorization.k8s.io,resources=roles;rolebindings,verbs=get;list;watch;create;patch;delete
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+
+func (r *MeshReconciler) Reconcile(ctx context.Context, request reconcile.Request) (result reconcile.Result, err error) {
 	log := r.Log.WithValues("Mesh", request.NamespacedName)
+	ctx, span := r.startReconcileSpan(ctx, request.Namespace, request.Name)
+	defer func() { endSpan(span, err) }()
 
 	// Fetch the Mesh instance
-	instance := &v1alpha1.Mesh{}
-	err := r.client.Get(ctx, request.NamespacedName, instance)
+	instance := &v1beta1.Mesh{}
+	err = r.Client.Get(ctx, request.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			log.Info("Mesh not found. Ignoring since object must be deleted")
+			forgetMeshMetrics(request.Namespace, request.Name)
 			return reconcile.Result{}, nil
 		}
 		log.Error(err, "Failed to get Mesh")
+		reconcileErrors.WithLabelValues(reasonGetFailed).Inc()
 		return reconcile.Result{}, err
 	}
 
-	// Define frontend deployment
-	frontendDeployment := &appsv1.Deployment{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "frontend",
-			Namespace: instance.Namespace,
-		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: &instance.Spec.Replicas,
-			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"app": "frontend",
-				},
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"app": "frontend",
-					},
-				},
-				Spec: corev1.PodSpec{
-					Volumes: []corev1.Volume{
-						corev1.Volume{
-							Name: "frontend-config",
-							VolumeSource: corev1.VolumeSource{
-								ConfigMap: &corev1.ConfigMapVolumeSource{
-									LocalObjectReference: corev1.LocalObjectReference{
-										Name: "frontend-config",
-									},
-								},
-							},
-						},
-						corev1.Volume{
-							Name: "frontend-secrets",
-							VolumeSource: corev1.VolumeSource{
-								Secret: &corev1.SecretVolumeSource{
-									SecretName: "frontend-secrets",
-								},
-							},
-						},
-					},
-					Containers: []corev1.Container{
-						corev1.Container{
-							Name:  "frontend",
-							Image: instance.Spec.FrontendImage,
-							VolumeMounts: []corev1.VolumeMount{
-								corev1.VolumeMount{
-									Name:      "frontend-config",
-									MountPath: "/etc/frontend",
-								},
-								corev1.VolumeMount{
-									Name:      "frontend-secrets",
-									MountPath: "/etc/frontend/secrets",
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-
-	// Define backend deployment
-	backendDeployment := &appsv1.Deployment{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "backend",
-			Namespace: instance.Namespace,
-		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: &instance.Spec.Replicas,
-			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"app": "backend",
-				},
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"app": "backend",
-					},
-				},
-				Spec: corev1.PodSpec{
-					Volumes: []corev1.Volume{
-						corev1.Volume{
-							Name: "backend-config",
-							VolumeSource: corev1.VolumeSource{
-								ConfigMap: &corev1.ConfigMapVolumeSource{
-									LocalObjectReference: corev1.LocalObjectReference{
-										Name: "backend-config",
-									},
-								},
-							},
-						},
-						corev1.Volume{
-							Name: "backend-secrets",
-							VolumeSource: corev1.VolumeSource{
-								Secret: &corev1.SecretVolumeSource{
-									SecretName: "backend-secrets",
-								},
-							},
-						},
-					},
-					Containers: []corev1.Container{
-						corev1.Container{
-							Name:  "backend",
-							Image: instance.Spec.BackendImage,
-							VolumeMounts: []corev1.VolumeMount{
-								corev1.VolumeMount{
-									Name:      "backend-config",
-									MountPath: "/etc/backend",
-								},
-								corev1.VolumeMount{
-									Name:      "backend-secrets",
-									MountPath: "/etc/backend/secrets",
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-
-	// Define app deployment
-	appDeployment := &appsv1.Deployment{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "app",
-			Namespace: instance.Namespace,
-		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: &instance.Spec.Replicas,
-			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"app": "app",
-				},
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"app": "app",
-					},
-				},
-				Spec: corev1.PodSpec{
-					Volumes: []corev1.Volume{
-						corev1.Volume{
-							Name: "app-config",
-							VolumeSource: corev1.VolumeSource{
-								ConfigMap: &corev1.ConfigMapVolumeSource{
-									LocalObjectReference: corev1.LocalObjectReference{
-										Name: "app-config",
-									},
-								},
-							},
-						},
-						corev1.Volume{
-							Name: "app-secrets",
-							VolumeSource: corev1.VolumeSource{
-								Secret: &corev1.SecretVolumeSource{
-									SecretName: "app-secrets",
-								},
-							},
-						},
-					},
-					Containers: []corev1.Container{
-						corev1.Container{
-							Name:  "app",
-							Image: instance.Spec.AppImage,
-							VolumeMounts: []corev1.VolumeMount{
-								corev1.VolumeMount{
-									Name:      "app-config",
-									MountPath: "/etc/app",
-								},
-								corev1.VolumeMount{
-									Name:      "app-secrets",
-									MountPath: "/etc/app/secrets",
-								},
-							},
-						},
-					},
-				},
-			},
-		},
-	}
-
-	// Define configmaps
-	frontendConfigMap := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "frontend-config",
-			Namespace: instance.Namespace,
-			Labels: map[string]string{
-				"app": "frontend",
-			},
-		},
-		Data: map[string]string{
-			"config.yaml": "frontend configuration",
-		},
-	}
-
-	backendConfigMap := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "backend-config",
-			Namespace: instance.Namespace,
-			Labels: map[string]string{
-				"app": "backend",
-			},
-		},
-		Data: map[string]string{
-			"config.yaml": "backend configuration",
-		},
-	}
-
-	appConfigMap := &corev1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "app-config",
-			Namespace: instance.Namespace,
-			Labels: map[string]string{
-				"app": "app",
-			},
-		},
-		Data: map[string]string{
-			"config.yaml": "app configuration",
-		},
-	}
-
-	// Define secrets
-	frontendSecret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "frontend-secrets",
-			Namespace: instance.Namespace,
-			Labels: map[string]string{
-				"app": "frontend",
-			},
-		},
-		StringData: map[string]string{
-			"secret.yaml": "frontend secret",
-		},
+	// Children of a Mesh in another shard still enqueue it.
+	if !r.Shard.Owns(instance) {
+		log.V(1).Info("Mesh belongs to another shard. Ignoring", "shard", r.Shard.Of(instance))
+		forgetMeshMetrics(request.Namespace, request.Name)
+		return reconcile.Result{}, nil
+	}
+
+	span.SetAttributes(attribute.Int64("mesh.generation", instance.Generation))
+
+	var applied map[string][]v1beta1.RenderedObject
+	var checks map[string]imageCheck
+
+	if err = r.applyTemplate(ctx, instance); err != nil {
+		log.Error(err, "Failed to get MeshTemplate", "MeshTemplate", instance.Spec.Template)
+		reconcileErrors.WithLabelValues(reasonTemplateFailed).Inc()
+		r.Recorder.Eventf(instance, corev1.EventTypeWarning, reasonTemplateFailed,
+			"Failed to get MeshTemplate %s: %v", instance.Spec.Template, err)
+	} else if instance.IsPaused() {
+		log.Info("Mesh is paused. Leaving its children alone")
+	} else {
+		_, pushed := r.imagePushes.LoadAndDelete(request.NamespacedName)
+		checks = r.updateImages(ctx, log, instance, pushed)
+		applied, err = r.reconcileChildren(ctx, log, instance)
+		for _, childErr := range splitErrors(err) {
+			reconcileErrors.WithLabelValues(errorReason(childErr)).Inc()
+			r.Recorder.Event(instance, corev1.EventTypeWarning, errorReason(childErr), childErr.Error())
+		}
 	}
-
-	backendSecret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "backend-secrets",
-			Namespace: instance.Namespace,
-			Labels: map[string]string{
-				"app": "backend",
-			},
-		},
-		StringData: map[string]string{
-			"secret.yaml": "backend secret",
-		},
+	if statusErr := r.updateStatus(ctx, instance, applied, checks, err); statusErr != nil {
+		log.Error(statusErr, "Failed to update Mesh status")
+		reconcileErrors.WithLabelValues(reasonStatusUpdateFailed).Inc()
+		if err == nil {
+			err = statusErr
+		}
 	}
-
-	appSecret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      "app-secrets",
-			Namespace: instance.Namespace,
-			Labels: map[string]string{
-				"app": "app",
-			},
-		},
-		StringData: map[string]string{
-			"secret.yaml": "app secret",
-		},
+	if err == nil && result.IsZero() {
+		result.RequeueAfter = r.RequeueInterval
+		if hasImageUpdates(instance) {
+			result.RequeueAfter = sooner(result.RequeueAfter, r.ImageUpdateInterval)
+		}
+		result.RequeueAfter = sooner(result.RequeueAfter, r.untilSecretRotation(ctx, instance))
+		if hasExternalSecrets(instance) {
+			result.RequeueAfter = sooner(result.RequeueAfter, r.SecretRefreshInterval)
+		}
 	}
+	return result, err
+}
 
-	// Set Mesh instance as the owner and controller
-	if err := ctrl.SetControllerReference(instance, frontendDeployment, r.client.Scheme()); err != nil {
-		return reconcile.Result{}, err
-	}
-	if err := ctrl.SetControllerReference(instance, backendDeployment, r.client.Scheme()); err != nil {
-		return reconcile.Result{}, err
-	}
-	if err := ctrl.SetControllerReference(instance, appDeployment, r.client.Scheme()); err != nil {
-		return reconcile.Result{}, err
-	}
-	if err := ctrl.SetControllerReference(instance, frontendConfigMap, r.client.Scheme()); err != nil {
-		return reconcile.Result{}, err
-	}
-	if err := ctrl.SetControllerReference(instance, backendConfigMap, r.client.Scheme()); err != nil {
-		return reconcile.Result{}, err
-	}
-	if err := ctrl.SetControllerReference(instance, appConfigMap, r.client.Scheme()); err != nil {
-		return reconcile.Result{}, err
-	}
-	if err := ctrl.SetControllerReference(instance, frontendSecret, r.client.Scheme()); err != nil {
-		return reconcile.Result{}, err
-	}
-	if err := ctrl.SetControllerReference(instance, backendSecret, r.client.Scheme()); err != nil {
-		return reconcile.Result{}, err
-	}
-	if err := ctrl.SetControllerReference(instance, appSecret, r.client.Scheme()); err != nil {
-		return reconcile.Result{}, err
+// sooner returns the shorter of two requeue delays, where zero means never.
+func sooner(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
 	}
+	return a
+}
 
-	// Check if the frontend deployment already exists, if not create a new one
-	foundFrontendDeployment := &appsv1.Deployment{}
-	err = r.client.Get(ctx, types.NamespacedName{Name: "frontend", Namespace: instance.Namespace}, foundFrontendDeployment)
-	if err != nil && errors.IsNotFound(err) {
-		log.Info("Creating a new Frontend Deployment", "Deployment.Namespace", frontendDeployment.Namespace, "Deployment.Name", frontendDeployment.Name)
-		err = r.client.Create(ctx, frontendDeployment)
-		if err != nil {
-			log.Error(err, "Failed to create new Frontend Deployment", "Deployment.Namespace", frontendDeployment.Namespace, "Deployment.Name", frontendDeployment.Name)
-			return reconcile.Result{}, err
+// reconcileChildren applies the desired child objects of every component of a
+// Mesh that is not paused, in dependency order. A failure does not stop the
+// other components from being reconciled; it only skips the rest of the
+// failed component, so that its Deployment never starts without its volumes.
+// The failures are returned together, along with every component whose
+// children were all applied, with the objects applied from its source if it
+// has one.
+func (r *MeshReconciler) reconcileChildren(ctx context.Context, log logr.Logger, instance *v1beta1.Mesh) (map[string][]v1beta1.RenderedObject, error) {
+	var errs []error
+	applied := map[string][]v1beta1.RenderedObject{}
+	var wait bool
+	// The Mesh CA is read, or created, once the first component that needs
+	// it passed the policy.
+	var ca *certificateAuthority
+	var caErr error
+	meshCA := func() (*certificateAuthority, error) {
+		if ca == nil && caErr == nil {
+			if ca, caErr = r.meshCA(ctx, log, instance); caErr != nil {
+				log.Error(caErr, "Failed to get Mesh CA")
+			}
 		}
-
-		// Deployment created successfully - return and requeue
-		return reconcile.Result{Requeue: true}, nil
-	} else if err != nil {
-		log.Error(err, "Failed to get Frontend Deployment")
-		return reconcile.Result{}, err
+		return ca, caErr
 	}
-
-	// Check if the backend deployment already exists, if not create a new one
-	foundBackendDeployment := &appsv1.Deployment{}
-	err = r.client.Get(ctx, types.NamespacedName{Name: "backend", Namespace: instance.Namespace}, foundBackendDeployment)
-	if err != nil && errors.IsNotFound(err) {
-		log.Info("Creating a new Backend Deployment", "Deployment.Namespace", backendDeployment.Namespace, "Deployment.Name", backendDeployment.Name)
-		err = r.client.Create(ctx, backendDeployment)
-		if err != nil {
-			log.Error(err, "Failed to create new Backend Deployment", "Deployment.Namespace", backendDeployment.Namespace, "Deployment.Name", backendDeployment.Name)
-			return reconcile.Result{}, err
+	for _, name := range render.ComponentNames {
+		spec := render.ComponentSpec(instance, name)
+		if spec.Paused {
+			log.Info("Component is paused. Leaving its children alone", "component", name)
+			continue
 		}
 
-		// Deployment created successfully - return and requeue
-		return reconcile.Result{Requeue: true}, nil
-	} else if err != nil {
-		log.Error(err, "Failed to get Backend Deployment")
-		return reconcile.Result{}, err
-	}
-
-	// Check if the app deployment already exists, if not create a new one
-	foundAppDeployment := &appsv1.Deployment{}
-	err = r.client.Get(ctx, types.NamespacedName{Name: "app", Namespace: instance.Namespace}, foundAppDeployment)
-	if err != nil && errors.IsNotFound(err) {
-		log.Info("Creating a new App Deployment", "Deployment.Namespace", appDeployment.Namespace, "Deployment.Name", appDeployment.Name)
-		err = r.client.Create(ctx, appDeployment)
-		if err != nil {
-			log.Error(err, "Failed to create new App Deployment", "Deployment.Namespace", appDeployment.Namespace, "Deployment.Name", appDeployment.Name)
-			return reconcile.Result{}, err
+		if spec.Source == nil {
+			children, restarting, err := r.componentChildren(ctx, log, instance, name, meshCA, wait)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			wait = wait || restarting
+			if err := r.applyChildren(ctx, log, instance, name, children); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			applied[name] = nil
+			if err := r.pruneServiceAccount(ctx, log, instance, name); err != nil {
+				errs = append(errs, err)
+			}
+			continue
 		}
-
-		// Deployment created successfully - return and requeue
-		return reconcile.Result{Requeue: true}, nil
-	} else if err != nil {
-		log.Error(err, "Failed to get App Deployment")
-		return reconcile.Result{}, err
-	}
-
-	// Check if the frontend configmap already exists, if not create a new one
-	foundFrontendConfigMap := &corev1.ConfigMap{}
-	err = r.client.Get(ctx, types.NamespacedName{Name: "frontend-config", Namespace: instance.Namespace}, foundFrontendConfigMap)
-	if err != nil && errors.IsNotFound(err) {
-		log.Info("Creating a new Frontend ConfigMap", "ConfigMap.Namespace", frontendConfigMap.Namespace, "ConfigMap.Name", frontendConfigMap.Name)
-		err = r.client.Create(ctx, frontendConfigMap)
+		rendered, err := r.reconcileSource(ctx, log, instance, name, spec.Source)
 		if err != nil {
-			log.Error(err, "Failed to create new Frontend ConfigMap", "ConfigMap.Namespace", frontendConfigMap.Namespace, "ConfigMap.Name", frontendConfigMap.Name)
-			return reconcile.Result{}, err
+			errs = append(errs, err)
+			continue
 		}
-	} else if err != nil {
-		log.Error(err, "Failed to get Frontend ConfigMap")
-		return reconcile.Result{}, err
+		applied[name] = rendered
 	}
+	return applied, utilerrors.NewAggregate(errs)
+}
 
-	// Check if the backend configmap already exists, if not create a new one
-	foundBackendConfigMap := &corev1.ConfigMap{}
-	err = r.client.Get(ctx, types.NamespacedName{Name: "backend-config", Namespace: instance.Namespace}, foundBackendConfigMap)
-	if err != nil && errors.IsNotFound(err) {
-		log.Info("Creating a new Backend ConfigMap", "ConfigMap.Namespace", backendConfigMap.Namespace, "ConfigMap.Name", backendConfigMap.Name)
-		err = r.client.Create(ctx, backendConfigMap)
-		if err != nil {
-			log.Error(err, "Failed to create new Backend ConfigMap", "ConfigMap.Namespace", backendConfigMap.Namespace, "ConfigMap.Name", backendConfigMap.Name)
-			return reconcile.Result{}, err
-		}
-	} else if err != nil {
-		log.Error(err, "Failed to get Backend ConfigMap")
-		return reconcile.Result{}, err
+// componentChildren returns the desired child objects of a built-in component:
+// its image resolved by the image policy, its Secret with its generated and
+// external values, and its Deployment with the hash of its secrets. The
+// children are checked against the policy before anything is generated or
+// read from a secret store, with the values of the Secret left empty. meshCA
+// returns the Mesh CA, which is only asked for if the component uses it. wait
+// and the returned restarting coordinate restarts for rotated secrets, as
+// described for setSecretsHash.
+func (r *MeshReconciler) componentChildren(ctx context.Context, log logr.Logger, instance *v1beta1.Mesh, name string, meshCA func() (*certificateAuthority, error), wait bool) (children []client.Object, restarting bool, err error) {
+	spec := render.ComponentSpec(instance, name)
+	image, err := r.resolveImage(ctx, instance, name, spec.Image)
+	if err != nil {
+		log.Error(err, "Failed to resolve image", "component", name, "image", spec.Image)
+		return nil, false, err
 	}
-
-	// Check if the app configmap already exists, if not create a new one
-	foundAppConfigMap := &corev1.ConfigMap{}
-	err = r.client.Get(ctx, types.NamespacedName{Name: "app-config", Namespace: instance.Namespace}, foundAppConfigMap)
-	if err != nil && errors.IsNotFound(err) {
-		log.Info("Creating a new App ConfigMap", "ConfigMap.Namespace", appConfigMap.Namespace, "ConfigMap.Name", appConfigMap.Name)
-		err = r.client.Create(ctx, appConfigMap)
-		if err != nil {
-			log.Error(err, "Failed to create new App ConfigMap", "ConfigMap.Namespace", appConfigMap.Namespace, "ConfigMap.Name", appConfigMap.Name)
-			return reconcile.Result{}, err
+	if err := r.checkPolicy(ctx, log, instance, name, render.Children(instance, name, image, policySecret(instance, name))); err != nil {
+		return nil, false, err
+	}
+	var ca *certificateAuthority
+	if usesCA(spec) {
+		if ca, err = meshCA(); err != nil {
+			return nil, false, &componentError{name, reasonSecretGenerationFailed, fmt.Errorf("Mesh CA: %w", err)}
 		}
-	} else if err != nil {
-		log.Error(err, "Failed to get App ConfigMap")
-		return reconcile.Result{}, err
 	}
-
-	// Check if the frontend secret already exists, if not create a new one
-	foundFrontendSecret := &corev1.Secret{}
-	err = r.client.Get(ctx, types.NamespacedName{Name: "frontend-secrets", Namespace: instance.Namespace}, foundFrontendSecret)
-	if err != nil && errors.IsNotFound(err) {
-		log.Info("Creating a new Frontend Secret", "Secret.Namespace", frontendSecret.Namespace, "Secret.Name", frontendSecret.Name)
-		err = r.client.Create(ctx, frontendSecret)
-		if err != nil {
-			log.Error(err, "Failed to create new Frontend Secret", "Secret.Namespace", frontendSecret.Namespace, "Secret.Name", frontendSecret.Name)
-			return reconcile.Result{}, err
+	secret, err := r.generateSecret(ctx, log, instance, name, ca)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := r.readExternalSecrets(ctx, log, instance, name, secret); err != nil {
+		return nil, false, err
+	}
+	children = render.Children(instance, name, image, secret)
+	for _, child := range children {
+		if deployment, ok := child.(*appsv1.Deployment); ok {
+			if restarting, err = r.setSecretsHash(ctx, log, instance, name, secret, deployment, wait); err != nil {
+				return nil, false, err
+			}
 		}
-	} else if err != nil {
-		log.Error(err, "Failed to get Frontend Secret")
-		return reconcile.Result{}, err
 	}
+	return children, restarting, nil
+}
 
-	// Check if the backend secret already exists, if not create a new one
-	foundBackendSecret := &corev1.Secret{}
-	err = r.client.Get(ctx, types.NamespacedName{Name: "backend-secrets", Namespace: instance.Namespace}, foundBackendSecret)
-	if err != nil && errors.IsNotFound(err) {
-		log.Info("Creating a new Backend Secret", "Secret.Namespace", backendSecret.Namespace, "Secret.Name", backendSecret.Name)
-		err = r.client.Create(ctx, backendSecret)
-		if err != nil {
-			log.Error(err, "Failed to create new Backend Secret", "Secret.Namespace", backendSecret.Namespace, "Secret.Name", backendSecret.Name)
-			return reconcile.Result{}, err
+// applyChildren applies the child objects of a component in order, stopping
+// at the first failure.
+func (r *MeshReconciler) applyChildren(ctx context.Context, log logr.Logger, instance *v1beta1.Mesh, component string, objects []client.Object) error {
+	for _, obj := range objects {
+		if _, err := r.reconcileChild(ctx, log, instance, component, obj); err != nil {
+			return err
 		}
-	} else if err != nil {
-		log.Error(err, "Failed to get Backend Secret")
-		return reconcile.Result{}, err
 	}
+	return nil
+}
 
-	// Check if the app secret already exists, if not create a new one
-	foundAppSecret := &corev1.Secret{}
-	err = r.client.Get(ctx, types.NamespacedName{Name: "app-secrets", Namespace: instance.Namespace}, foundAppSecret)
-	if err != nil && errors.IsNotFound(err) {
-		log.Info("Creating a new App Secret", "Secret.Namespace", appSecret.Namespace, "Secret.Name", appSecret.Name)
-		err = r.client.Create(ctx, appSecret)
-		if err != nil {
-			log.Error(err, "Failed to create new App Secret", "Secret.Namespace", appSecret.Namespace, "Secret.Name", appSecret.Name)
-			return reconcile.Result{}, err
-		}
-	} else if err != nil {
-		log.Error(err, "Failed to get App Secret")
-		return reconcile.Result{}, err
+// SetupWithManager sets up the controller with the Manager. When sharding is
+// enabled the controller is named after its shard, so that the workqueue
+// metrics, such as workqueue_depth, are reported per shard.
+func (r *MeshReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1beta1.Mesh{}, templateIndex, indexTemplate); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &v1beta1.Mesh{}, referencedSecretsIndex, indexReferencedSecrets); err != nil {
+		return err
 	}
 
-	// Deployment and ConfigMaps/Secrets created successfully
-	// Reconciliation is complete
-	return reconcile.Result{}, nil
+	name := "mesh"
+	if r.Shard.Enabled() {
+		name = fmt.Sprintf("mesh-shard-%d", r.Shard.ID)
+	}
+	b := ctrl.NewControllerManagedBy(mgr).
+		Named(name).
+		For(&v1beta1.Mesh{}, builder.WithPredicates(r.meshPredicate())).
+		Owns(&appsv1.Deployment{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&corev1.Secret{}).
+		Owns(&corev1.ServiceAccount{}).
+		Owns(&rbacv1.Role{}).
+		Owns(&rbacv1.RoleBinding{}).
+		Watches(&v1beta1.MeshTemplate{}, handler.EnqueueRequestsFromMapFunc(r.meshesForTemplate)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.meshesForSecret)).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+			RateLimiter:             r.RateLimiter,
+		})
+	if r.ImageEvents != nil {
+		b = b.WatchesRawSource(&source.Channel{Source: r.ImageEvents}, handler.Funcs{
+			GenericFunc: func(ctx context.Context, e event.GenericEvent, q workqueue.RateLimitingInterface) {
+				key := client.ObjectKeyFromObject(e.Object)
+				r.imagePushes.Store(key, true)
+				q.Add(reconcile.Request{NamespacedName: key})
+			},
+		})
+	}
+	return b.Complete(r)
 }
@@ -0,0 +1,160 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+func TestReconcileSinglePass(t *testing.T) {
+	ctx := context.Background()
+	r := newTestReconciler(t, newTestMesh())
+
+	var order []string
+	for _, obj := range render.Children(newTestMesh(), render.Frontend, "frontend:1.0", render.Secret("default", render.Frontend)) {
+		order = append(order, obj.GetName())
+	}
+	if want := "frontend-config frontend-secrets frontend"; strings.Join(order, " ") != want {
+		t.Errorf("apply order: got %v, want %s", order, want)
+	}
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "mesh-sample", Namespace: "default"}}
+	result, err := r.Reconcile(ctx, request)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if !result.IsZero() {
+		t.Errorf("Reconcile asked to be requeued: %+v", result)
+	}
+	for _, name := range render.ComponentNames {
+		key := types.NamespacedName{Name: name, Namespace: "default"}
+		if err := r.Client.Get(ctx, key, &appsv1.Deployment{}); err != nil {
+			t.Errorf("Deployment %s: %v", name, err)
+		}
+		key.Name = name + "-config"
+		if err := r.Client.Get(ctx, key, &corev1.ConfigMap{}); err != nil {
+			t.Errorf("ConfigMap %s: %v", key.Name, err)
+		}
+		key.Name = name + "-secrets"
+		if err := r.Client.Get(ctx, key, &corev1.Secret{}); err != nil {
+			t.Errorf("Secret %s: %v", key.Name, err)
+		}
+	}
+}
+
+func TestReconcilePaused(t *testing.T) {
+	ctx := context.Background()
+	mesh := newTestMesh()
+	mesh.Annotations = map[string]string{v1beta1.PausedAnnotation: "true"}
+	r := newTestReconciler(t, mesh)
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "mesh-sample", Namespace: "default"}}
+
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: render.Frontend, Namespace: "default"}, &appsv1.Deployment{})
+	if !errors.IsNotFound(err) {
+		t.Fatalf("paused Mesh got a Deployment: %v", err)
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	condition := meta.FindStatusCondition(mesh.Status.Conditions, v1beta1.ConditionPaused)
+	if condition == nil || condition.Reason != "MeshPaused" {
+		t.Errorf("Paused condition: got %v, want reason MeshPaused", condition)
+	}
+	for _, component := range mesh.Status.Components {
+		if !component.Paused {
+			t.Errorf("component %s is not reported as paused", component.Name)
+		}
+	}
+
+	delete(mesh.Annotations, v1beta1.PausedAnnotation)
+	mesh.Spec.Components.Backend.Paused = true
+	if err := r.Client.Update(ctx, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	for _, name := range render.ComponentNames {
+		err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: "default"}, &appsv1.Deployment{})
+		if name == render.Backend && !errors.IsNotFound(err) {
+			t.Errorf("paused component %s got a Deployment: %v", name, err)
+		}
+		if name != render.Backend && err != nil {
+			t.Errorf("resumed component %s: %v", name, err)
+		}
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	condition = meta.FindStatusCondition(mesh.Status.Conditions, v1beta1.ConditionPaused)
+	if condition == nil || condition.Reason != "ComponentsPaused" || condition.Message != "Reconciliation is paused for backend" {
+		t.Errorf("Paused condition: got %v, want backend paused", condition)
+	}
+}
+
+func TestSecretMissingEvent(t *testing.T) {
+	ctx := context.Background()
+	mesh := newTestMesh()
+	deployment := render.Deployment(mesh.Namespace, render.Backend, render.ComponentSpec(mesh, render.Backend), nil)
+	r := newTestReconciler(t, mesh, deployment)
+	events := r.Recorder.(*record.FakeRecorder).Events
+	key := types.NamespacedName{Name: "mesh-sample", Namespace: "default"}
+	missing := func() int {
+		var n int
+		for len(events) > 0 {
+			if strings.HasPrefix(<-events, "Warning "+reasonSecretMissing) {
+				n++
+			}
+		}
+		return n
+	}
+
+	// A status that could not be written reports nothing, as the retry
+	// reports it.
+	c := r.Client
+	r.Client = interceptor.NewClient(c.(client.WithWatch), interceptor.Funcs{
+		SubResourceUpdate: func(ctx context.Context, c client.Client, subResourceName string, obj client.Object, opts ...client.SubResourceUpdateOption) error {
+			return errors.NewConflict(v1beta1.GroupVersion.WithResource("meshes").GroupResource(), obj.GetName(), nil)
+		},
+	})
+	if err := r.updateStatus(ctx, mesh, nil, nil, nil); err == nil {
+		t.Fatalf("updateStatus succeeded despite the conflict")
+	}
+	if n := missing(); n != 0 {
+		t.Errorf("got %d %s Events for a status that was not written, want 0", n, reasonSecretMissing)
+	}
+	r.Client = c
+
+	for i := 0; i < 2; i++ {
+		if err := r.Client.Get(ctx, key, mesh); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.updateStatus(ctx, mesh, nil, nil, nil); err != nil {
+			t.Fatalf("updateStatus: %v", err)
+		}
+	}
+	if n := missing(); n != 1 {
+		t.Errorf("got %d %s Events over two status updates, want 1", n, reasonSecretMissing)
+	}
+	for _, component := range mesh.Status.Components {
+		if component.Name == render.Backend && component.Reason != reasonSecretMissing {
+			t.Errorf("backend status: got reason %s, want %s", component.Reason, reasonSecretMissing)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+// componentError records which component a reconcile failure belongs to, so
+// that the failure can be surfaced in that component's status.
+type componentError struct {
+	component string
+	reason    string
+	err       error
+}
+
+func (e *componentError) Error() string {
+	return fmt.Sprintf("%s: %v", e.component, e.err)
+}
+
+func (e *componentError) Unwrap() error {
+	return e.err
+}
+
+// splitErrors returns the errors aggregated in err.
+func splitErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if agg, ok := err.(utilerrors.Aggregate); ok {
+		return agg.Errors()
+	}
+	return []error{err}
+}
+
+// updateStatus recomputes the per-component status of a Mesh from its child
+// objects and writes it if it changed. applied holds the components whose
+// children were all applied in the reconcile pass, with the objects applied
+// from their sources, checks the outcome of the
+// components checked for image updates, and reconcileErr the error the pass
+// returned, if any.
+func (r *MeshReconciler) updateStatus(ctx context.Context, instance *v1beta1.Mesh, applied map[string][]v1beta1.RenderedObject, checks map[string]imageCheck, reconcileErr error) error {
+	failed := map[string]*componentError{}
+	for _, err := range splitErrors(reconcileErr) {
+		if ce, ok := err.(*componentError); ok {
+			failed[ce.component] = ce
+		}
+	}
+
+	status := v1beta1.MeshStatus{ObservedGeneration: instance.Generation}
+	ready := 0
+	for _, name := range render.ComponentNames {
+		component, err := r.componentStatus(ctx, instance, name)
+		if err != nil {
+			return err
+		}
+		if ce, ok := failed[name]; ok {
+			component.Phase = v1beta1.MeshPhaseFailed
+			component.Reason = ce.reason
+			component.Message = ce.err.Error()
+		}
+
+		component.LastTransitionTime = metav1.Now()
+		for _, previous := range instance.Status.Components {
+			if previous.Name == name && previous.Phase == component.Phase {
+				component.LastTransitionTime = previous.LastTransitionTime
+			}
+		}
+		rendered, ok := applied[name]
+		switch {
+		case ok:
+			component.Rendered = rendered
+		case render.ComponentSpec(instance, name).Source != nil:
+			// Keep tracking what was applied last, so it can still be pruned.
+			component.Rendered = previousRendered(instance, name)
+		}
+		if !ok && !component.Paused && resumed(instance, name) {
+			// Until its children are applied, the next reconcile must
+			// still force them.
+			component.Paused = true
+		}
+		if check, ok := checks[name]; ok {
+			component.PendingImage = check.pending
+			component.LastImageCheck = &check.at
+		} else if render.ComponentSpec(instance, name).ImageUpdate != nil {
+			component.PendingImage = previousPendingImage(instance, name)
+			component.LastImageCheck = previousImageCheck(instance, name)
+		}
+
+		if component.Phase == v1beta1.MeshPhaseReady {
+			ready++
+		}
+		status.Components = append(status.Components, component)
+	}
+	status.Phase = meshPhase(status.Components)
+	status.Ready = fmt.Sprintf("%d/%d", ready, len(status.Components))
+	status.Conditions = append([]metav1.Condition(nil), instance.Status.Conditions...)
+	setConflictCondition(&status, instance.Generation, failed, reconcileErr)
+	setPausedCondition(&status, instance)
+	setVerifiedCondition(&status, instance, len(r.SignatureKeys) > 0, failed, reconcileErr)
+	setPolicyCondition(&status, instance, r.Policy != nil, failed, reconcileErr)
+
+	previous := instance.Status
+	if !equality.Semantic.DeepEqual(previous, status) {
+		instance.Status = status
+		if err := r.Client.Status().Update(ctx, instance); err != nil {
+			return err
+		}
+	}
+	// Only once the status is written, so that a retried reconcile does not
+	// report or observe the same transitions twice.
+	r.recordRolloutEvents(instance, previous, status)
+	r.recordPauseEvents(instance, previous, status)
+	r.recordSecretEvents(instance, previous, status)
+	recordMeshMetrics(instance, previous, status)
+	return nil
+}
+
+// previousPendingImage returns the image of component that awaited approval
+// when the Mesh was last reconciled, unless it has been approved since.
+func previousPendingImage(instance *v1beta1.Mesh, component string) string {
+	for _, status := range instance.Status.Components {
+		if status.Name == component && status.PendingImage != render.ComponentSpec(instance, component).Image {
+			return status.PendingImage
+		}
+	}
+	return ""
+}
+
+// setConflictCondition records in status whether the last reconcile hit
+// apply conflicts. The condition is left as it was when the reconcile failed
+// for other reasons only, since the conflicting child may not have been
+// reached.
+func setConflictCondition(status *v1beta1.MeshStatus, generation int64, failed map[string]*componentError, reconcileErr error) {
+	condition := metav1.Condition{
+		Type:               v1beta1.ConditionConflict,
+		ObservedGeneration: generation,
+	}
+	var conflicts []string
+	for _, name := range render.ComponentNames {
+		if ce, ok := failed[name]; ok && ce.reason == reasonApplyConflict {
+			conflicts = append(conflicts, ce.Error())
+		}
+	}
+	switch {
+	case len(conflicts) > 0:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = reasonApplyConflict
+		condition.Message = strings.Join(conflicts, "; ")
+	case reconcileErr == nil:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Applied"
+		condition.Message = "All child objects were applied"
+	default:
+		return
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+}
+
+// setVerifiedCondition records in status whether the images of the
+// components passed signature verification. It is removed when the operator
+// has no signature keys.
+func setVerifiedCondition(status *v1beta1.MeshStatus, instance *v1beta1.Mesh, enabled bool, failed map[string]*componentError, reconcileErr error) {
+	if !enabled {
+		meta.RemoveStatusCondition(&status.Conditions, v1beta1.ConditionImagesVerified)
+		return
+	}
+	condition := metav1.Condition{
+		Type:               v1beta1.ConditionImagesVerified,
+		ObservedGeneration: instance.Generation,
+	}
+	var unverified []string
+	for _, name := range render.ComponentNames {
+		if ce, ok := failed[name]; ok && ce.reason == reasonSignatureVerificationFailed {
+			unverified = append(unverified, ce.Error())
+		}
+	}
+	switch {
+	case len(unverified) > 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonSignatureVerificationFailed
+		condition.Message = strings.Join(unverified, "; ")
+	case reconcileErr == nil:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Verified"
+		condition.Message = "The images of all components are signed with a trusted key"
+	default:
+		return
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+}
+
+// setPolicyCondition records in status whether the child objects of the
+// components comply with the operator's policy. The condition is removed when
+// there is no policy.
+func setPolicyCondition(status *v1beta1.MeshStatus, instance *v1beta1.Mesh, enabled bool, failed map[string]*componentError, reconcileErr error) {
+	if !enabled {
+		meta.RemoveStatusCondition(&status.Conditions, v1beta1.ConditionPolicyCompliant)
+		return
+	}
+	condition := metav1.Condition{
+		Type:               v1beta1.ConditionPolicyCompliant,
+		ObservedGeneration: instance.Generation,
+	}
+	var violations []string
+	reason := reasonPolicyViolation
+	for _, name := range render.ComponentNames {
+		if ce, ok := failed[name]; ok && (ce.reason == reasonPolicyViolation || ce.reason == reasonPolicyEvaluationFailed) {
+			violations = append(violations, ce.Error())
+			if ce.reason == reasonPolicyEvaluationFailed {
+				reason = reasonPolicyEvaluationFailed
+			}
+		}
+	}
+	switch {
+	case len(violations) > 0:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reason
+		condition.Message = strings.Join(violations, "; ")
+	case reconcileErr == nil:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Compliant"
+		condition.Message = "The child objects of all components comply with the policy"
+	default:
+		return
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+}
+
+// setPausedCondition records in status whether the Mesh or any of its
+// components is paused.
+func setPausedCondition(status *v1beta1.MeshStatus, instance *v1beta1.Mesh) {
+	condition := metav1.Condition{
+		Type:               v1beta1.ConditionPaused,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: instance.Generation,
+		Reason:             "Reconciling",
+		Message:            "The operator is reconciling every component",
+	}
+	var paused []string
+	for _, component := range status.Components {
+		if component.Paused {
+			paused = append(paused, component.Name)
+		}
+	}
+	switch {
+	case instance.IsPaused():
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "MeshPaused"
+		condition.Message = "Reconciliation of the Mesh is paused"
+	case len(paused) > 0:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "ComponentsPaused"
+		condition.Message = "Reconciliation is paused for " + strings.Join(paused, ", ")
+	}
+	meta.SetStatusCondition(&status.Conditions, condition)
+}
+
+// componentStatus reads the Deployment, ConfigMap and Secret of a component
+// and summarises them.
+func (r *MeshReconciler) componentStatus(ctx context.Context, instance *v1beta1.Mesh, name string) (v1beta1.ComponentStatus, error) {
+	component := v1beta1.ComponentStatus{
+		Name:            name,
+		Phase:           v1beta1.MeshPhasePending,
+		DesiredReplicas: 1,
+		Reason:          "DeploymentNotFound",
+	}
+	spec := render.ComponentSpec(instance, name)
+	if replicas := instance.Spec.ReplicasFor(spec); replicas != nil {
+		component.DesiredReplicas = *replicas
+	}
+	component.Paused = instance.IsPaused() || spec.Paused
+
+	deployment := &appsv1.Deployment{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: instance.Namespace}, deployment)
+	if err != nil && !errors.IsNotFound(err) {
+		return component, err
+	}
+	if err == nil {
+		setDeploymentStatus(&component, deployment)
+	}
+
+	// A component rendered from a source is tracked through the Deployment
+	// named after it, if the source renders one, and has no built-in
+	// ConfigMap and Secret.
+	if spec.Source != nil {
+		if errors.IsNotFound(err) {
+			component.Phase = v1beta1.MeshPhaseReady
+			component.Reason = "SourceApplied"
+		}
+		return component, nil
+	}
+
+	configMap := &corev1.ConfigMap{}
+	err = r.Client.Get(ctx, types.NamespacedName{Name: name + "-config", Namespace: instance.Namespace}, configMap)
+	if err != nil && !errors.IsNotFound(err) {
+		return component, err
+	}
+	secret := &corev1.Secret{}
+	err = r.Client.Get(ctx, types.NamespacedName{Name: name + "-secrets", Namespace: instance.Namespace}, secret)
+	if err != nil && !errors.IsNotFound(err) {
+		return component, err
+	}
+	if errors.IsNotFound(err) && component.Phase != v1beta1.MeshPhasePending && component.Phase != v1beta1.MeshPhaseFailed {
+		component.Reason = reasonSecretMissing
+		component.Message = fmt.Sprintf("Deployment %s references Secret %s which does not exist", name, name+"-secrets")
+	}
+	component.ConfigHash = configHash(configMap, secret)
+
+	return component, nil
+}
+
+// setDeploymentStatus copies the replica counts and image of a Deployment into
+// component and derives the component's phase from them.
+func setDeploymentStatus(component *v1beta1.ComponentStatus, deployment *appsv1.Deployment) {
+	if deployment.Spec.Replicas != nil {
+		component.DesiredReplicas = *deployment.Spec.Replicas
+	}
+	component.ReadyReplicas = deployment.Status.ReadyReplicas
+	component.UpdatedReplicas = deployment.Status.UpdatedReplicas
+	component.AvailableReplicas = deployment.Status.AvailableReplicas
+	if len(deployment.Spec.Template.Spec.Containers) > 0 {
+		component.Image = deployment.Spec.Template.Spec.Containers[0].Image
+		component.ImageDigest = imageDigest(component.Image)
+	}
+	if rotatedAt, err := time.Parse(time.RFC3339, deployment.Annotations[secretsRotatedAtAnnotation]); err == nil {
+		component.LastSecretRotation = &metav1.Time{Time: rotatedAt}
+	}
+
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentReplicaFailure && condition.Status == corev1.ConditionTrue {
+			component.Phase = v1beta1.MeshPhaseFailed
+			component.Reason = condition.Reason
+			component.Message = condition.Message
+			return
+		}
+		if condition.Type == appsv1.DeploymentProgressing && condition.Status == corev1.ConditionFalse {
+			component.Phase = v1beta1.MeshPhaseFailed
+			component.Reason = condition.Reason
+			component.Message = condition.Message
+			return
+		}
+	}
+
+	switch {
+	case deployment.Status.ObservedGeneration < deployment.Generation,
+		component.UpdatedReplicas < component.DesiredReplicas,
+		deployment.Status.Replicas > component.UpdatedReplicas:
+		component.Phase = v1beta1.MeshPhaseProgressing
+		component.Reason = "RolloutInProgress"
+	case component.AvailableReplicas < component.DesiredReplicas:
+		component.Phase = v1beta1.MeshPhaseDegraded
+		component.Reason = "ReplicasUnavailable"
+	default:
+		component.Phase = v1beta1.MeshPhaseReady
+		component.Reason = "ReplicasAvailable"
+	}
+}
+
+// meshPhase folds the phases of all components into the phase of the Mesh.
+func meshPhase(components []v1beta1.ComponentStatus) v1beta1.MeshPhase {
+	counts := map[v1beta1.MeshPhase]int{}
+	for _, component := range components {
+		counts[component.Phase]++
+	}
+	switch {
+	case counts[v1beta1.MeshPhaseFailed] > 0:
+		return v1beta1.MeshPhaseFailed
+	case counts[v1beta1.MeshPhaseDegraded] > 0:
+		return v1beta1.MeshPhaseDegraded
+	case counts[v1beta1.MeshPhasePending] == len(components):
+		return v1beta1.MeshPhasePending
+	case counts[v1beta1.MeshPhaseReady] == len(components):
+		return v1beta1.MeshPhaseReady
+	default:
+		return v1beta1.MeshPhaseProgressing
+	}
+}
+
+// configHash returns a short, stable hash of the data in a ConfigMap and a
+// Secret. Missing objects hash as empty.
+func configHash(configMap *corev1.ConfigMap, secret *corev1.Secret) string {
+	h := sha256.New()
+	keys := make([]string, 0, len(configMap.Data))
+	for k := range configMap.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "configmap/%s=%s\n", k, configMap.Data[k])
+	}
+
+	keys = keys[:0]
+	for k := range secret.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "secret/%s=%s\n", k, secret.Data[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+var (
+	componentReadyReplicas = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mesh_component_ready_replicas",
+			Help: "Number of ready replicas of a Mesh component.",
+		},
+		[]string{"namespace", "mesh", "component"},
+	)
+	componentDesiredReplicas = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mesh_component_desired_replicas",
+			Help: "Number of desired replicas of a Mesh component.",
+		},
+		[]string{"namespace", "mesh", "component"},
+	)
+	reconcileErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "mesh_reconcile_errors_total",
+			Help: "Total number of Mesh reconcile errors by reason.",
+		},
+		[]string{"reason"},
+	)
+	rolloutDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "mesh_rollout_duration_seconds",
+			Help:    "Time a Mesh component spent progressing before becoming ready.",
+			Buckets: prometheus.ExponentialBuckets(5, 2, 10),
+		},
+		[]string{"component"},
+	)
+	meshInfo = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "mesh_info",
+			Help: "Information about a Mesh, labelled with the image of each component. Always 1.",
+		},
+		[]string{"namespace", "mesh", "frontend_image", "backend_image", "app_image"},
+	)
+)
+
+func init() {
+	metrics.Registry.MustRegister(
+		componentReadyReplicas,
+		componentDesiredReplicas,
+		reconcileErrors,
+		rolloutDuration,
+		meshInfo,
+	)
+}
+
+// errorReason returns the reason label recorded for a reconcile error.
+func errorReason(err error) string {
+	var ce *componentError
+	if errors.As(err, &ce) {
+		return ce.reason
+	}
+	return reasonReconcileFailed
+}
+
+// recordMeshMetrics updates the gauges of a Mesh from its new status and
+// observes the duration of every rollout that completed since previous.
+func recordMeshMetrics(instance *v1beta1.Mesh, previous, status v1beta1.MeshStatus) {
+	for _, component := range status.Components {
+		labels := prometheus.Labels{"namespace": instance.Namespace, "mesh": instance.Name, "component": component.Name}
+		componentReadyReplicas.With(labels).Set(float64(component.ReadyReplicas))
+		componentDesiredReplicas.With(labels).Set(float64(component.DesiredReplicas))
+
+		for _, old := range previous.Components {
+			if old.Name == component.Name && old.Phase == v1beta1.MeshPhaseProgressing && component.Phase == v1beta1.MeshPhaseReady {
+				rolloutDuration.WithLabelValues(component.Name).Observe(time.Since(old.LastTransitionTime.Time).Seconds())
+			}
+		}
+	}
+
+	meshInfo.DeletePartialMatch(prometheus.Labels{"namespace": instance.Namespace, "mesh": instance.Name})
+	meshInfo.With(prometheus.Labels{
+		"namespace":      instance.Namespace,
+		"mesh":           instance.Name,
+		"frontend_image": instance.Spec.Components.Frontend.Image,
+		"backend_image":  instance.Spec.Components.Backend.Image,
+		"app_image":      instance.Spec.Components.App.Image,
+	}).Set(1)
+}
+
+// forgetMeshMetrics drops every series of a deleted Mesh.
+func forgetMeshMetrics(namespace, name string) {
+	labels := prometheus.Labels{"namespace": namespace, "mesh": name}
+	componentReadyReplicas.DeletePartialMatch(labels)
+	componentDesiredReplicas.DeletePartialMatch(labels)
+	meshInfo.DeletePartialMatch(labels)
+}
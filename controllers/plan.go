@@ -0,0 +1,335 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+// PlanAction is what reconciling a Mesh would do to one of its child objects.
+type PlanAction string
+
+const (
+	PlanCreate PlanAction = "create"
+	PlanUpdate PlanAction = "update"
+	PlanDelete PlanAction = "delete"
+)
+
+// sensitiveValue replaces the values of Secrets in a plan.
+const sensitiveValue = "(sensitive)"
+
+// PlannedChange is a change reconciling a Mesh would make to a child object.
+type PlannedChange struct {
+	Action     PlanAction `json:"action"`
+	Component  string     `json:"component,omitempty"`
+	APIVersion string     `json:"apiVersion"`
+	Kind       string     `json:"kind"`
+	Name       string     `json:"name"`
+
+	// Fields are the fields an update changes.
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// FieldChange is a field of a child object that an update changes.
+type FieldChange struct {
+	// Path is the path of the field, such as
+	// spec.template.spec.containers[0].image.
+	Path    string      `json:"path"`
+	Live    interface{} `json:"live,omitempty"`
+	Desired interface{} `json:"desired,omitempty"`
+}
+
+// Plan returns the changes reconciling instance would make to its child
+// objects, in the order Reconcile would make them, by rendering them as
+// Reconcile does and comparing them with the objects r.Client reads. Only the
+// fields the operator sets are compared, so a field it stops setting is not
+// reported. existing are further objects taken to be children of instance,
+// such as those of a directory of manifests; those that would not be applied
+// are reported as deleted.
+//
+// Rendering reads what Reconcile reads and would create a missing Mesh CA, so
+// r.Client should be a dry-run client. Failures of single components are
+// returned together with the changes of the other components.
+func (r *MeshReconciler) Plan(ctx context.Context, instance *v1beta1.Mesh, existing []client.Object) ([]PlannedChange, error) {
+	log := r.Log.WithValues("Mesh", client.ObjectKeyFromObject(instance))
+	if err := r.applyTemplate(ctx, instance); err != nil {
+		return nil, fmt.Errorf("MeshTemplate %s: %w", instance.Spec.Template, err)
+	}
+	if instance.IsPaused() {
+		return nil, nil
+	}
+
+	var changes []PlannedChange
+	var errs []error
+	applied := map[string]bool{}
+	plan := func(component string, obj client.Object) {
+		change, err := r.planChild(ctx, component, obj)
+		if err != nil {
+			errs = append(errs, &componentError{component, reasonGetFailed, err})
+			return
+		}
+		applied[change.Kind+"/"+change.Name] = true
+		if change.Action != "" {
+			changes = append(changes, change)
+		}
+	}
+	remove := func(component string, obj client.Object) {
+		gvk := obj.GetObjectKind().GroupVersionKind()
+		if applied[gvk.Kind+"/"+obj.GetName()] {
+			return
+		}
+		applied[gvk.Kind+"/"+obj.GetName()] = true
+		changes = append(changes, PlannedChange{
+			Action: PlanDelete, Component: component,
+			APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind, Name: obj.GetName(),
+		})
+	}
+
+	var ca *certificateAuthority
+	if usesMeshCA(instance) {
+		caSecret := types.NamespacedName{Name: instance.Name + "-ca", Namespace: instance.Namespace}
+		err := r.Client.Get(ctx, caSecret, &corev1.Secret{})
+		switch {
+		case errors.IsNotFound(err):
+			changes = append(changes, PlannedChange{Action: PlanCreate, APIVersion: "v1", Kind: "Secret", Name: caSecret.Name})
+		case err != nil:
+			return nil, err
+		}
+		applied["Secret/"+caSecret.Name] = true
+		if ca, err = r.meshCA(ctx, log, instance); err != nil {
+			return nil, fmt.Errorf("Mesh CA: %w", err)
+		}
+	}
+
+	var wait bool
+	for _, name := range render.ComponentNames {
+		spec := render.ComponentSpec(instance, name)
+		if spec.Paused {
+			continue
+		}
+		var children []client.Object
+		if spec.Source == nil {
+			objects, restarting, err := r.componentChildren(ctx, log, instance, name, func() (*certificateAuthority, error) { return ca, nil }, wait)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			wait = wait || restarting
+			children = objects
+		} else {
+			objects, err := r.renderSource(ctx, instance, name, spec.Source)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for _, obj := range objects {
+				children = append(children, obj)
+			}
+			if err := r.checkPolicy(ctx, log, instance, name, children); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		for _, child := range children {
+			plan(name, child)
+		}
+
+		if spec.Source == nil {
+			stale, err := r.staleServiceAccount(ctx, instance, name)
+			if err != nil {
+				errs = append(errs, &componentError{name, reasonGetFailed, err})
+				continue
+			}
+			for _, obj := range stale {
+				remove(name, obj)
+			}
+			continue
+		}
+		var rendered []v1beta1.RenderedObject
+		for _, child := range children {
+			gvk := child.GetObjectKind().GroupVersionKind()
+			rendered = append(rendered, v1beta1.RenderedObject{APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind, Name: child.GetName()})
+		}
+		for _, ref := range staleRendered(instance, name, rendered) {
+			obj, err := r.controlledRendered(ctx, instance, ref)
+			if err != nil {
+				errs = append(errs, &componentError{name, reasonGetFailed, err})
+				continue
+			}
+			if obj != nil {
+				remove(name, obj)
+			}
+		}
+	}
+
+	for _, obj := range existing {
+		if obj.GetObjectKind().GroupVersionKind().Kind == "Mesh" {
+			continue
+		}
+		remove("", obj)
+	}
+	return changes, utilerrors.NewAggregate(errs)
+}
+
+// planChild returns the change applying obj, a child of component, would
+// make. Its Action is empty if it would change nothing.
+func (r *MeshReconciler) planChild(ctx context.Context, component string, obj client.Object) (PlannedChange, error) {
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
+		return PlannedChange{}, err
+	}
+	change := PlannedChange{Component: component, APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind, Name: obj.GetName()}
+
+	live := &unstructured.Unstructured{}
+	live.SetGroupVersionKind(gvk)
+	err = r.Client.Get(ctx, client.ObjectKeyFromObject(obj), live)
+	if errors.IsNotFound(err) {
+		change.Action = PlanCreate
+		return change, nil
+	}
+	if err != nil {
+		return PlannedChange{}, err
+	}
+
+	content, err := toUnstructured(obj)
+	if err != nil {
+		return PlannedChange{}, err
+	}
+	desired := map[string]interface{}{}
+	for field, value := range content {
+		switch field {
+		case "metadata", "status", "apiVersion", "kind":
+		default:
+			desired[field] = value
+		}
+	}
+	metadata := map[string]interface{}{}
+	if labels := obj.GetLabels(); len(labels) > 0 {
+		metadata["labels"] = stringMap(labels)
+	}
+	if annotations := obj.GetAnnotations(); len(annotations) > 0 {
+		metadata["annotations"] = stringMap(annotations)
+	}
+	desired["metadata"] = metadata
+
+	change.Fields = diffFields("", desired, live.Object)
+	if gvk.Kind == "Secret" {
+		for i, field := range change.Fields {
+			if field.Path == "data" || strings.HasPrefix(field.Path, "data.") {
+				change.Fields[i] = redact(field)
+			}
+		}
+	}
+	if len(change.Fields) > 0 {
+		change.Action = PlanUpdate
+	}
+	return change, nil
+}
+
+// diffFields returns the fields set in desired whose value differs in live.
+// Lists of the same length are compared element by element, so that fields
+// defaulted in live do not count as changes.
+func diffFields(path string, desired, live interface{}) []FieldChange {
+	switch desired := desired.(type) {
+	case map[string]interface{}:
+		if len(desired) == 0 {
+			return nil
+		}
+		liveMap, ok := live.(map[string]interface{})
+		if !ok {
+			return []FieldChange{{Path: path, Live: live, Desired: desired}}
+		}
+		keys := make([]string, 0, len(desired))
+		for key := range desired {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var changes []FieldChange
+		for _, key := range keys {
+			if desired[key] == nil {
+				continue
+			}
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			changes = append(changes, diffFields(fieldPath, desired[key], liveMap[key])...)
+		}
+		return changes
+	case []interface{}:
+		if len(desired) == 0 {
+			return nil
+		}
+		liveList, ok := live.([]interface{})
+		if !ok || len(liveList) != len(desired) {
+			return []FieldChange{{Path: path, Live: live, Desired: desired}}
+		}
+		var changes []FieldChange
+		for i := range desired {
+			changes = append(changes, diffFields(fmt.Sprintf("%s[%d]", path, i), desired[i], liveList[i])...)
+		}
+		return changes
+	default:
+		if !equalValues(desired, live) {
+			return []FieldChange{{Path: path, Live: live, Desired: desired}}
+		}
+		return nil
+	}
+}
+
+// equalValues reports whether two scalar values of unstructured objects are
+// equal, whatever the type their numbers were decoded as.
+func equalValues(a, b interface{}) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	default:
+		return 0, false
+	}
+}
+
+// redact hides the values of a field of a Secret, keeping whether it is set.
+func redact(field FieldChange) FieldChange {
+	if field.Live != nil {
+		field.Live = sensitiveValue
+	}
+	if field.Desired != nil {
+		field.Desired = sensitiveValue
+	}
+	return field
+}
+
+func stringMap(m map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+// planOf returns the changes r would make to the Mesh key, planned with a
+// dry-run client.
+func planOf(t *testing.T, r *MeshReconciler, key types.NamespacedName) []PlannedChange {
+	t.Helper()
+	ctx := context.Background()
+	mesh := &v1beta1.Mesh{}
+	if err := r.Client.Get(ctx, key, mesh); err != nil {
+		t.Fatal(err)
+	}
+	c := r.Client
+	r.Client = client.NewDryRunClient(c)
+	defer func() { r.Client = c }()
+	changes, err := r.Plan(ctx, mesh, nil)
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	return changes
+}
+
+func findChange(changes []PlannedChange, kind, name string) *PlannedChange {
+	for i := range changes {
+		if changes[i].Kind == kind && changes[i].Name == name {
+			return &changes[i]
+		}
+	}
+	return nil
+}
+
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+	mesh := newTestMesh()
+	mesh.Spec.Components.Backend.ServiceAccount = &v1beta1.ComponentServiceAccount{
+		Rules: []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"get"}}},
+	}
+	mesh.Spec.Components.App.ExternalSecrets = []v1beta1.ExternalSecret{{Key: "password", Ref: "kubernetes://db#password"}}
+	db := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: mesh.Namespace, Labels: map[string]string{v1beta1.ExternalSecretLabel: "true"}},
+		Data:       map[string][]byte{"password": []byte("first")},
+	}
+	r := newTestReconciler(t, mesh, db)
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}}
+
+	// Before the first reconcile every child is created, and planning
+	// creates none of them.
+	changes := planOf(t, r, request.NamespacedName)
+	for kind, name := range map[string]string{
+		"Deployment": render.Backend, "ConfigMap": render.Backend + "-config", "Secret": render.Backend + "-secrets",
+		"ServiceAccount": render.Backend, "Role": render.Backend, "RoleBinding": render.Backend,
+	} {
+		if change := findChange(changes, kind, name); change == nil || change.Action != PlanCreate {
+			t.Errorf("%s %s: got %+v, want a create", kind, name, change)
+		}
+	}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: render.Backend + "-config", Namespace: mesh.Namespace}, &corev1.ConfigMap{}); !errors.IsNotFound(err) {
+		t.Errorf("Plan created the backend ConfigMap: %v", err)
+	}
+
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if changes := planOf(t, r, request.NamespacedName); len(changes) != 0 {
+		t.Errorf("Plan after reconcile: got %+v, want no changes", changes)
+	}
+
+	// A new image updates the Deployment's container image only; dropping
+	// the rules deletes the Role and RoleBinding.
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	mesh.Spec.Components.Frontend.Image = "frontend:2.0"
+	mesh.Spec.Components.Backend.ServiceAccount.Rules = nil
+	if err := r.Client.Update(ctx, mesh); err != nil {
+		t.Fatal(err)
+	}
+	changes = planOf(t, r, request.NamespacedName)
+	update := findChange(changes, "Deployment", render.Frontend)
+	if update == nil || update.Action != PlanUpdate {
+		t.Fatalf("frontend Deployment: got %+v, want an update", update)
+	}
+	var imageChanged bool
+	for _, field := range update.Fields {
+		if field.Path == "spec.template.spec.containers[0].image" {
+			imageChanged = field.Live == "frontend:1.0" && field.Desired == "frontend:2.0"
+		}
+	}
+	if !imageChanged {
+		t.Errorf("frontend Deployment fields: got %+v, want the image changed to frontend:2.0", update.Fields)
+	}
+	for _, kind := range []string{"Role", "RoleBinding"} {
+		if change := findChange(changes, kind, render.Backend); change == nil || change.Action != PlanDelete {
+			t.Errorf("backend %s: got %+v, want a delete", kind, change)
+		}
+	}
+	if change := findChange(changes, "ServiceAccount", render.Backend); change != nil {
+		t.Errorf("backend ServiceAccount: got %+v, want no change", change)
+	}
+
+	// Changed secret values are reported without their values.
+	db.Data["password"] = []byte("second")
+	if err := r.Client.Update(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	changes = planOf(t, r, request.NamespacedName)
+	secret := findChange(changes, "Secret", render.App+"-secrets")
+	if secret == nil || secret.Action != PlanUpdate {
+		t.Fatalf("app Secret: got %+v, want an update", secret)
+	}
+	var redacted bool
+	for _, field := range secret.Fields {
+		if field.Path == "data.password" {
+			redacted = field.Live == sensitiveValue && field.Desired == sensitiveValue
+		}
+	}
+	if !redacted {
+		t.Errorf("app Secret fields: got %+v, want data.password changed and redacted", secret.Fields)
+	}
+}
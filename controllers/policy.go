@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	logr "github.com/go-logr/logr"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/yaml"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+// policyCostLimit bounds the cost of evaluating a rule against one object,
+// so that a rule cannot stall reconciles.
+const policyCostLimit = 1000000
+
+// policyRule is a rule of the policy ConfigMap, stored as YAML under the
+// rule's name.
+type policyRule struct {
+	// Kinds are the kinds of child objects the rule applies to. It applies
+	// to every kind when empty.
+	Kinds []string `json:"kinds,omitempty"`
+
+	// Expression is a CEL expression that must be true for the object. It
+	// sees the object as object and the Mesh as mesh.
+	Expression string `json:"expression"`
+
+	// Message describes a violation of the rule.
+	Message string `json:"message,omitempty"`
+}
+
+// compiledRule is a policyRule ready to be evaluated.
+type compiledRule struct {
+	name    string
+	kinds   []string
+	message string
+	program cel.Program
+}
+
+// PolicyEngine evaluates the child objects of Meshes against rules written
+// as CEL expressions, read from a ConfigMap. The rules are compiled again
+// whenever the ConfigMap changes. A missing ConfigMap has no rules.
+type PolicyEngine struct {
+	// Reader reads the ConfigMap, once for every component reconciled, so
+	// it should read from a cache that holds the ConfigMap's namespace.
+	Reader client.Reader
+
+	// ConfigMap is the ConfigMap holding the rules.
+	ConfigMap types.NamespacedName
+
+	mu              sync.Mutex
+	resourceVersion string
+	rules           []compiledRule
+}
+
+// NewPolicyEngine returns a PolicyEngine for the rules in the ConfigMap key.
+func NewPolicyEngine(reader client.Reader, key types.NamespacedName) *PolicyEngine {
+	return &PolicyEngine{Reader: reader, ConfigMap: key}
+}
+
+// loadRules returns the rules of the ConfigMap, compiling them if it changed
+// since they were last compiled.
+func (e *PolicyEngine) loadRules(ctx context.Context) ([]compiledRule, error) {
+	configMap := &corev1.ConfigMap{}
+	err := e.Reader.Get(ctx, e.ConfigMap, configMap)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("policy ConfigMap %s: %w", e.ConfigMap, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if configMap.ResourceVersion != "" && configMap.ResourceVersion == e.resourceVersion {
+		return e.rules, nil
+	}
+	rules, err := compileRules(configMap.Data)
+	if err != nil {
+		return nil, fmt.Errorf("policy ConfigMap %s: %w", e.ConfigMap, err)
+	}
+	e.resourceVersion, e.rules = configMap.ResourceVersion, rules
+	return rules, nil
+}
+
+// compileRules compiles the rules in the data of a policy ConfigMap, in the
+// order of their names.
+func compileRules(data map[string]string) ([]compiledRule, error) {
+	env, err := cel.NewEnv(
+		cel.Variable("object", cel.DynType),
+		cel.Variable("mesh", cel.DynType),
+		ext.Strings(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	rules := make([]compiledRule, 0, len(names))
+	for _, name := range names {
+		var rule policyRule
+		if err := yaml.UnmarshalStrict([]byte(data[name]), &rule); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		if rule.Expression == "" {
+			return nil, fmt.Errorf("rule %s has no expression", name)
+		}
+		ast, issues := env.Compile(rule.Expression)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("rule %s: %w", name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+			return nil, fmt.Errorf("rule %s: expression is of type %s, not bool", name, ast.OutputType())
+		}
+		program, err := env.Program(ast, cel.CostLimit(policyCostLimit))
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", name, err)
+		}
+		message := rule.Message
+		if message == "" {
+			message = "must satisfy " + rule.Expression
+		}
+		rules = append(rules, compiledRule{name: name, kinds: rule.Kinds, message: message, program: program})
+	}
+	return rules, nil
+}
+
+// Evaluate returns the violations of the rules by objects, the child
+// objects of mesh. A rule that fails to evaluate counts as violated.
+func (e *PolicyEngine) Evaluate(ctx context.Context, scheme *runtime.Scheme, mesh *v1beta1.Mesh, objects []client.Object) ([]string, error) {
+	rules, err := e.loadRules(ctx)
+	if err != nil || len(rules) == 0 {
+		return nil, err
+	}
+	meshObject, err := toUnstructured(mesh)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []string
+	for _, obj := range objects {
+		gvk, err := apiutil.GVKForObject(obj, scheme)
+		if err != nil {
+			return nil, err
+		}
+		object, err := toUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range rules {
+			if len(rule.kinds) > 0 && !containsString(rule.kinds, gvk.Kind) {
+				continue
+			}
+			out, _, err := rule.program.ContextEval(ctx, map[string]interface{}{"object": object, "mesh": meshObject})
+			switch {
+			case err != nil:
+				violations = append(violations, fmt.Sprintf("%s %s violates rule %s: %v", gvk.Kind, obj.GetName(), rule.name, err))
+			case out.Value() != true:
+				violations = append(violations, fmt.Sprintf("%s %s violates rule %s: %s", gvk.Kind, obj.GetName(), rule.name, rule.message))
+			}
+		}
+	}
+	return violations, nil
+}
+
+// toUnstructured returns the content of obj as it is serialized.
+func toUnstructured(obj runtime.Object) (map[string]interface{}, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.Object, nil
+	}
+	return runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// policySecret returns the Secret of a component as the policy sees it: with
+// the keys of its generated and external values, but without the values,
+// which are only generated or read once its children passed the policy.
+func policySecret(instance *v1beta1.Mesh, component string) *corev1.Secret {
+	secret := render.Secret(instance.Namespace, component)
+	secret.Data = map[string][]byte{}
+	spec := render.ComponentSpec(instance, component)
+	for _, generated := range spec.GeneratedSecrets {
+		for _, key := range generatedKeys(generated) {
+			secret.Data[key] = []byte{}
+		}
+	}
+	for _, external := range spec.ExternalSecrets {
+		secret.Data[external.Key] = []byte{}
+	}
+	return secret
+}
+
+// checkPolicy evaluates the child objects of a component against the
+// policy, if there is one, before they are applied. Any violation fails the
+// component with a reasonPolicyViolation error listing all of them, so that
+// none of its objects are applied.
+func (r *MeshReconciler) checkPolicy(ctx context.Context, log logr.Logger, instance *v1beta1.Mesh, component string, objects []client.Object) error {
+	if r.Policy == nil {
+		return nil
+	}
+	violations, err := r.Policy.Evaluate(ctx, r.Scheme, instance, objects)
+	if err != nil {
+		log.Error(err, "Failed to evaluate policy", "component", component)
+		return &componentError{component, reasonPolicyEvaluationFailed, err}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	log.Info("Child objects violate the policy. Not applying them", "component", component, "violations", violations)
+	return &componentError{component, reasonPolicyViolation, fmt.Errorf("%s", strings.Join(violations, "; "))}
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+func TestReconcilePolicy(t *testing.T) {
+	ctx := context.Background()
+	policy := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "mesh-policy", Namespace: "mesh-system"},
+		Data: map[string]string{
+			"corp-registry": `
+kinds: [Deployment]
+expression: object.spec.template.spec.containers.all(c, c.image.startsWith("registry.corp/"))
+message: images must come from registry.corp`,
+			"max-replicas": `
+kinds: [Deployment]
+expression: object.metadata.namespace == "prod" || !has(object.spec.replicas) || object.spec.replicas <= 20`,
+			"no-host-path": `
+kinds: [Deployment]
+expression: object.spec.template.spec.volumes.all(v, !has(v.hostPath))
+message: hostPath volumes are not allowed`,
+		},
+	}
+	mesh := newTestMesh()
+	for _, component := range render.ComponentNames {
+		render.ComponentSpecRef(mesh, component).Image = "registry.corp/" + component + ":1.0"
+	}
+	mesh.Spec.Components.Backend.Volumes = []corev1.Volume{{
+		Name:         "host",
+		VolumeSource: corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/var/run"}},
+	}}
+	mesh.Spec.Components.App.Image = "docker.io/app:1.0"
+	r := newTestReconciler(t, mesh, policy)
+	r.Policy = NewPolicyEngine(r.Client, client.ObjectKeyFromObject(policy))
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}}
+
+	if _, err := r.Reconcile(ctx, request); err == nil {
+		t.Fatalf("Reconcile succeeded with children violating the policy")
+	}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: render.Frontend, Namespace: mesh.Namespace}, &appsv1.Deployment{}); err != nil {
+		t.Errorf("compliant frontend was not applied: %v", err)
+	}
+	for _, component := range []string{render.Backend, render.App} {
+		if err := r.Client.Get(ctx, types.NamespacedName{Name: component, Namespace: mesh.Namespace}, &appsv1.Deployment{}); err == nil {
+			t.Errorf("%s Deployment violating the policy was applied", component)
+		}
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	condition := meta.FindStatusCondition(mesh.Status.Conditions, v1beta1.ConditionPolicyCompliant)
+	if condition == nil || condition.Status != metav1.ConditionFalse ||
+		!strings.Contains(condition.Message, "hostPath volumes are not allowed") ||
+		!strings.Contains(condition.Message, "images must come from registry.corp") {
+		t.Errorf("PolicyCompliant condition: got %v", condition)
+	}
+	var warnings int
+	for len(r.Recorder.(*record.FakeRecorder).Events) > 0 {
+		if event := <-r.Recorder.(*record.FakeRecorder).Events; strings.HasPrefix(event, "Warning "+reasonPolicyViolation) {
+			warnings++
+		}
+	}
+	if warnings != 2 {
+		t.Errorf("got %d PolicyViolation events, want 2", warnings)
+	}
+
+	mesh.Spec.Components.Backend.Volumes = nil
+	mesh.Spec.Components.App.Image = "registry.corp/app:1.0"
+	if err := r.Client.Update(ctx, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionTrue(mesh.Status.Conditions, v1beta1.ConditionPolicyCompliant) {
+		t.Errorf("PolicyCompliant condition is not True: %v", mesh.Status.Conditions)
+	}
+
+	// A rule that does not compile blocks every component.
+	policy.Data["broken"] = "expression: object.spec.("
+	if err := r.Client.Update(ctx, policy); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err == nil {
+		t.Fatalf("Reconcile succeeded with a broken policy")
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if mesh.Status.Components[0].Reason != reasonPolicyEvaluationFailed {
+		t.Errorf("frontend reason: got %q, want %s", mesh.Status.Components[0].Reason, reasonPolicyEvaluationFailed)
+	}
+}
+
+// countingSecretProvider counts the secrets read from it.
+type countingSecretProvider struct {
+	reads int
+}
+
+func (p *countingSecretProvider) GetSecret(ctx context.Context, namespace, path, key string) ([]byte, error) {
+	p.reads++
+	return []byte("value"), nil
+}
+
+func TestPolicyBeforeSideEffects(t *testing.T) {
+	ctx := context.Background()
+	policy := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "mesh-policy", Namespace: "mesh-system"},
+		Data: map[string]string{
+			"no-latest": `
+kinds: [Deployment]
+expression: object.spec.template.spec.containers.all(c, !c.image.endsWith(":latest"))`,
+			"db-password": `
+kinds: [Secret]
+expression: object.metadata.name != "backend-secrets" || "db-password" in object.data`,
+		},
+	}
+	mesh := newTestMesh()
+	mesh.Spec.Components.Backend.Image = "backend:latest"
+	mesh.Spec.Components.Backend.GeneratedSecrets = []v1beta1.GeneratedSecret{{Key: "tls", Certificate: &v1beta1.CertificateGenerator{DNSNames: []string{"backend.default.svc"}}}}
+	mesh.Spec.Components.Backend.ExternalSecrets = []v1beta1.ExternalSecret{{Key: "db-password", Ref: "counting://db#password"}}
+	r := newTestReconciler(t, mesh, policy)
+	r.Policy = NewPolicyEngine(r.Client, client.ObjectKeyFromObject(policy))
+	provider := &countingSecretProvider{}
+	r.SecretProviders = map[string]SecretProvider{"counting": provider}
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}}
+
+	if _, err := r.Reconcile(ctx, request); err == nil {
+		t.Fatalf("Reconcile succeeded with children violating the policy")
+	}
+	if provider.reads != 0 {
+		t.Errorf("read %d external secrets of a component violating the policy", provider.reads)
+	}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: mesh.Name + "-ca", Namespace: mesh.Namespace}, &corev1.Secret{}); err == nil {
+		t.Errorf("created the Mesh CA for a component violating the policy")
+	}
+
+	// Once compliant, the component gets its values; the rule on the
+	// Secret saw its keys before they had any.
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	mesh.Spec.Components.Backend.Image = "backend:1.0"
+	if err := r.Client.Update(ctx, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: "backend-secrets", Namespace: mesh.Namespace}, secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data["db-password"]) != "value" || len(secret.Data["tls.crt"]) == 0 {
+		t.Errorf("backend Secret: got keys %v", secret.Data)
+	}
+}
@@ -0,0 +1,41 @@
+package controllers
+
+import (
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/ratelimiter"
+)
+
+// NewRateLimiter returns a workqueue rate limiter that delays the retries of
+// a Mesh exponentially from baseDelay up to maxDelay, and limits all retries
+// together to qps per second with bursts of burst.
+func NewRateLimiter(baseDelay, maxDelay time.Duration, qps float64, burst int) ratelimiter.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(qps), burst)},
+	)
+}
+
+// meshPredicate filters the events of the Meshes a reconciler watches to
+// those of its shard, dropping updates that only change the status. Label and
+// annotation changes are kept since they can move a Mesh between shards or
+// pause it. A Mesh moved to another shard is still passed to the shard it
+// left, which then forgets its metrics.
+func (r *MeshReconciler) meshPredicate() predicate.Predicate {
+	owned := predicate.NewPredicateFuncs(r.Shard.Owns)
+	owned.UpdateFunc = func(e event.UpdateEvent) bool {
+		return r.Shard.Owns(e.ObjectNew) || r.Shard.Owns(e.ObjectOld)
+	}
+	return predicate.And(
+		owned,
+		predicate.Or(
+			predicate.GenerationChangedPredicate{},
+			predicate.LabelChangedPredicate{},
+			predicate.AnnotationChangedPredicate{},
+		),
+	)
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+func TestMeshPredicate(t *testing.T) {
+	p := (&MeshReconciler{}).meshPredicate()
+	old := newTestMesh()
+
+	statusOnly := old.DeepCopy()
+	statusOnly.Status.Phase = v1beta1.MeshPhaseReady
+	if p.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: statusOnly}) {
+		t.Errorf("status-only update was not filtered")
+	}
+
+	specChange := old.DeepCopy()
+	specChange.Generation++
+	if !p.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: specChange}) {
+		t.Errorf("spec update was filtered")
+	}
+
+	paused := old.DeepCopy()
+	paused.Annotations = map[string]string{v1beta1.PausedAnnotation: "true"}
+	if !p.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: paused}) {
+		t.Errorf("annotation update was filtered")
+	}
+}
+
+func TestReconcileRequeueInterval(t *testing.T) {
+	mesh := newTestMesh()
+	mesh.Spec.Paused = true
+	r := newTestReconciler(t, mesh)
+	r.RequeueInterval = time.Minute
+
+	result, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Name: "mesh-sample", Namespace: "default"}})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if result.RequeueAfter != time.Minute {
+		t.Errorf("RequeueAfter: got %v, want %v", result.RequeueAfter, time.Minute)
+	}
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	logr "github.com/go-logr/logr"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+const (
+	// secretsHashAnnotation is the pod template annotation of a component's
+	// Deployment that holds a hash of the secrets the component uses, so
+	// that changing them restarts it.
+	secretsHashAnnotation = "mesh.com/secrets-hash"
+
+	// secretsRotatedAtAnnotation is the annotation of a component's
+	// Deployment that records when it was last restarted for its secrets.
+	secretsRotatedAtAnnotation = "mesh.com/secrets-rotated-at"
+)
+
+// referencedSecretsIndex indexes Meshes by the names of the Secrets their
+// components reference.
+const referencedSecretsIndex = "spec.components.referencedSecrets"
+
+func indexReferencedSecrets(obj client.Object) []string {
+	mesh := obj.(*v1beta1.Mesh)
+	var names []string
+	for _, component := range render.ComponentNames {
+		for _, ref := range render.ComponentSpec(mesh, component).ReferencedSecrets {
+			names = append(names, ref.Name)
+		}
+	}
+	return names
+}
+
+// meshesForSecret maps a Secret to the Meshes in its namespace that reference
+// it, so that they restart the components using it when it changes.
+func (r *MeshReconciler) meshesForSecret(ctx context.Context, secret client.Object) []reconcile.Request {
+	meshes := &v1beta1.MeshList{}
+	if err := r.Client.List(ctx, meshes, client.InNamespace(secret.GetNamespace()),
+		client.MatchingFields{referencedSecretsIndex: secret.GetName()}); err != nil {
+		r.Log.Error(err, "Failed to list the Meshes referencing a Secret", "Secret", client.ObjectKeyFromObject(secret))
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(meshes.Items))
+	for _, mesh := range meshes.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&mesh)})
+	}
+	return requests
+}
+
+// setSecretsHash sets the hash of the secrets of a component on the pod
+// template of deployment, so that the component restarts when they change.
+// Restarts are coordinated in the order components are reconciled: while
+// wait is true the hash of the live Deployment is kept, and the rollout of
+// the component waited for triggers the reconcile that restarts this one. It
+// reports whether the component has a restart pending or rolling out, which
+// the components after it must wait for.
+func (r *MeshReconciler) setSecretsHash(ctx context.Context, log logr.Logger, instance *v1beta1.Mesh, component string, secret *corev1.Secret, deployment *appsv1.Deployment, wait bool) (bool, error) {
+	spec := render.ComponentSpec(instance, component)
+	if len(spec.GeneratedSecrets) == 0 && len(spec.ReferencedSecrets) == 0 && len(spec.ExternalSecrets) == 0 {
+		return false, nil
+	}
+	hash, err := r.secretsHash(ctx, instance, spec, secret)
+	if err != nil {
+		return false, &componentError{component, reasonGetFailed, err}
+	}
+
+	live := &appsv1.Deployment{}
+	err = r.Client.Get(ctx, types.NamespacedName{Name: deployment.Name, Namespace: deployment.Namespace}, live)
+	if err != nil && !errors.IsNotFound(err) {
+		return false, &componentError{component, reasonGetFailed, err}
+	}
+	liveHash := live.Spec.Template.Annotations[secretsHashAnnotation]
+	rotatedAt := live.Annotations[secretsRotatedAtAnnotation]
+	restart := liveHash != "" && liveHash != hash
+	switch {
+	case restart && wait:
+		log.Info("Secrets changed. Waiting for the restart of an earlier component", "component", component)
+		hash = liveHash
+	case restart:
+		rotatedAt = metav1.Now().UTC().Format(time.RFC3339)
+		log.Info("Secrets changed. Restarting", "component", component)
+		r.Recorder.Eventf(instance, corev1.EventTypeNormal, reasonSecretsRestart,
+			"Restarting %s to pick up its rotated secrets", component)
+	}
+
+	if deployment.Spec.Template.Annotations == nil {
+		deployment.Spec.Template.Annotations = map[string]string{}
+	}
+	deployment.Spec.Template.Annotations[secretsHashAnnotation] = hash
+	if rotatedAt != "" {
+		if deployment.Annotations == nil {
+			deployment.Annotations = map[string]string{}
+		}
+		deployment.Annotations[secretsRotatedAtAnnotation] = rotatedAt
+	}
+	return restart || (rotatedAt != "" && !rolledOut(live)), nil
+}
+
+// secretsHash returns a hash of the generated and external values in the
+// Secret of a component and of the data of the Secrets it references. Previous values
+// kept during a grace period are left out, so that dropping them does not
+// restart the component.
+func (r *MeshReconciler) secretsHash(ctx context.Context, instance *v1beta1.Mesh, spec v1beta1.ComponentSpec, secret *corev1.Secret) (string, error) {
+	h := sha256.New()
+	for _, generated := range spec.GeneratedSecrets {
+		for _, key := range generatedKeys(generated) {
+			fmt.Fprintf(h, "generated/%s=%x\n", key, secret.Data[key])
+		}
+	}
+	for _, external := range spec.ExternalSecrets {
+		fmt.Fprintf(h, "external/%s=%x\n", external.Key, secret.Data[external.Key])
+	}
+	for _, ref := range spec.ReferencedSecrets {
+		referenced := &corev1.Secret{}
+		err := r.Client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: instance.Namespace}, referenced)
+		if errors.IsNotFound(err) {
+			fmt.Fprintf(h, "referenced/%s missing\n", ref.Name)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		keys := make([]string, 0, len(referenced.Data))
+		for key := range referenced.Data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(h, "referenced/%s/%s=%x\n", ref.Name, key, referenced.Data[key])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+// rolledOut reports whether every pod of a Deployment runs its current pod
+// template.
+func rolledOut(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas >= replicas &&
+		deployment.Status.Replicas == deployment.Status.UpdatedReplicas
+}
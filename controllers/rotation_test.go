@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+func TestReconcileSecretRotation(t *testing.T) {
+	ctx := context.Background()
+	mesh := newTestMesh()
+	for _, component := range []string{render.Backend, render.App} {
+		render.ComponentSpecRef(mesh, component).GeneratedSecrets = []v1beta1.GeneratedSecret{{
+			Key:      "password",
+			Password: &v1beta1.PasswordGenerator{},
+			Rotation: &v1beta1.SecretRotation{GracePeriod: &metav1.Duration{Duration: time.Hour}},
+		}}
+	}
+	mesh.Spec.Components.Frontend.ReferencedSecrets = []corev1.LocalObjectReference{{Name: "external"}}
+	external := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "external", Namespace: mesh.Namespace},
+		Data:       map[string][]byte{"token": []byte("a")},
+	}
+	r := newTestReconciler(t, mesh, external)
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}}
+	deployments := func() map[string]*appsv1.Deployment {
+		t.Helper()
+		result := map[string]*appsv1.Deployment{}
+		for _, component := range render.ComponentNames {
+			deployment := &appsv1.Deployment{}
+			if err := r.Client.Get(ctx, types.NamespacedName{Name: component, Namespace: mesh.Namespace}, deployment); err != nil {
+				t.Fatal(err)
+			}
+			result[component] = deployment
+		}
+		return result
+	}
+
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	before := deployments()
+	for _, component := range render.ComponentNames {
+		if before[component].Spec.Template.Annotations[secretsHashAnnotation] == "" {
+			t.Errorf("%s: no secrets hash on the pod template", component)
+		}
+	}
+
+	// A rotation requested on the Mesh restarts the backend first; the app
+	// waits for its rollout.
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	mesh.Annotations = map[string]string{v1beta1.RotateSecretsAnnotation: "1"}
+	if err := r.Client.Update(ctx, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	after := deployments()
+	if after[render.Backend].Spec.Template.Annotations[secretsHashAnnotation] == before[render.Backend].Spec.Template.Annotations[secretsHashAnnotation] {
+		t.Errorf("backend was not restarted after its secrets rotated")
+	}
+	if after[render.Backend].Annotations[secretsRotatedAtAnnotation] == "" {
+		t.Errorf("backend rotation time was not recorded")
+	}
+	if after[render.App].Spec.Template.Annotations[secretsHashAnnotation] != before[render.App].Spec.Template.Annotations[secretsHashAnnotation] {
+		t.Errorf("app restarted while the backend was rolling out")
+	}
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: "backend-secrets", Namespace: mesh.Namespace}, secret); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := secret.Data["password"+previousSuffix]; !ok {
+		t.Errorf("previous password is not kept during the grace period: %v", secret.Data)
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if mesh.Status.Components[1].LastSecretRotation == nil {
+		t.Errorf("backend status has no last secret rotation")
+	}
+
+	// Once the backend has rolled out, the app restarts.
+	backend := after[render.Backend]
+	backend.Status = appsv1.DeploymentStatus{ObservedGeneration: backend.Generation, Replicas: 1, UpdatedReplicas: 1}
+	if err := r.Client.Status().Update(ctx, backend); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if deployments()[render.App].Spec.Template.Annotations[secretsHashAnnotation] == before[render.App].Spec.Template.Annotations[secretsHashAnnotation] {
+		t.Errorf("app was not restarted after the backend rolled out")
+	}
+
+	// A change of a referenced Secret restarts the component using it.
+	external.Data["token"] = []byte("b")
+	if err := r.Client.Update(ctx, external); err != nil {
+		t.Fatal(err)
+	}
+	if requests := r.meshesForSecret(ctx, external); len(requests) != 1 || requests[0] != request {
+		t.Errorf("meshesForSecret: got %v, want %v", requests, request)
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if deployments()[render.Frontend].Spec.Template.Annotations[secretsHashAnnotation] == before[render.Frontend].Spec.Template.Annotations[secretsHashAnnotation] {
+		t.Errorf("frontend was not restarted after its referenced Secret changed")
+	}
+}
@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	logr "github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+// maxVaultResponse bounds the size of a response read from Vault.
+const maxVaultResponse = 1 << 20
+
+// SecretProvider reads secret values from a secret store.
+type SecretProvider interface {
+	// GetSecret returns the value of key in the secret at path, for a Mesh
+	// in namespace.
+	GetSecret(ctx context.Context, namespace, path, key string) ([]byte, error)
+}
+
+// KubernetesSecretProvider reads values from Secrets in the namespace of the
+// Mesh. The path of a value is the name of its Secret. Since the operator may
+// read every Secret of the namespace, only Secrets that opt in with the
+// v1beta1.ExternalSecretLabel are read, and never one a Mesh controls, such
+// as the Mesh CA.
+type KubernetesSecretProvider struct {
+	Client client.Client
+}
+
+// GetSecret implements SecretProvider.
+func (p *KubernetesSecretProvider) GetSecret(ctx context.Context, namespace, path, key string) ([]byte, error) {
+	secret := &corev1.Secret{}
+	if err := p.Client.Get(ctx, types.NamespacedName{Name: path, Namespace: namespace}, secret); err != nil {
+		return nil, err
+	}
+	if owner := metav1.GetControllerOf(secret); owner != nil && owner.Kind == "Mesh" && strings.HasPrefix(owner.APIVersion, v1beta1.GroupVersion.Group+"/") {
+		return nil, fmt.Errorf("Secret %s is managed by Mesh %s and cannot be read", path, owner.Name)
+	}
+	if secret.Labels[v1beta1.ExternalSecretLabel] != "true" {
+		return nil, fmt.Errorf("Secret %s is not labelled %s=true", path, v1beta1.ExternalSecretLabel)
+	}
+	value, ok := secret.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("Secret %s has no key %s", path, key)
+	}
+	return value, nil
+}
+
+// VaultSecretProvider reads values from the KV version 2 secrets engine of a
+// Vault server. The first element of the path of a value is the mount of the
+// engine and the rest the path of the secret in it, below the subtree of the
+// Mesh's namespace: secret/db is read from secret/<PathPrefix>/<namespace>/db.
+// A Mesh can thus only read the secrets kept for its namespace.
+type VaultSecretProvider struct {
+	// Address is the URL of the Vault server, such as
+	// https://vault.vault.svc:8200.
+	Address string
+
+	// Token authenticates the requests.
+	Token string
+
+	// PathPrefix is the path in every mount below which the subtrees of the
+	// namespaces are. The subtrees are at the root of the mount when empty.
+	PathPrefix string
+
+	// HTTPClient sends the requests. Defaults to a client that gives up
+	// after defaultVaultTimeout.
+	HTTPClient *http.Client
+}
+
+// defaultVaultTimeout bounds a request to Vault sent without an HTTPClient.
+const defaultVaultTimeout = 10 * time.Second
+
+// vaultKVResponse is the part of a KV version 2 read response that is used.
+type vaultKVResponse struct {
+	Data struct {
+		Data map[string]interface{} `json:"data"`
+	} `json:"data"`
+	Errors []string `json:"errors"`
+}
+
+// GetSecret implements SecretProvider.
+func (p *VaultSecretProvider) GetSecret(ctx context.Context, namespace, path, key string) ([]byte, error) {
+	u, err := p.secretURL(namespace, path)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", p.Token)
+	httpClient := p.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultVaultTimeout}
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var body vaultKVResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxVaultResponse)).Decode(&body); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("reading Vault secret %s: %w", path, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("Vault secret %s not found", path)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("reading Vault secret %s: %s %s", path, resp.Status, strings.Join(body.Errors, "; "))
+	}
+	value, ok := body.Data.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("Vault secret %s has no key %s", path, key)
+	}
+	if s, ok := value.(string); ok {
+		return []byte(s), nil
+	}
+	return json.Marshal(value)
+}
+
+// secretURL returns the URL of the secret at path for a Mesh in namespace.
+// Elements that would leave the subtree of namespace are rejected.
+func (p *VaultSecretProvider) secretURL(namespace, path string) (string, error) {
+	mount, secretPath, ok := strings.Cut(strings.Trim(path, "/"), "/")
+	if !ok || secretPath == "" {
+		return "", fmt.Errorf("Vault path %q is not of the form <mount>/<path>", path)
+	}
+	elements := []string{"v1", mount, "data"}
+	if prefix := strings.Trim(p.PathPrefix, "/"); prefix != "" {
+		elements = append(elements, strings.Split(prefix, "/")...)
+	}
+	elements = append(elements, namespace)
+	elements = append(elements, strings.Split(secretPath, "/")...)
+	for i, element := range elements {
+		if element == "" || element == "." || element == ".." {
+			return "", fmt.Errorf("Vault path %q leaves the secrets of namespace %s", path, namespace)
+		}
+		elements[i] = url.PathEscape(element)
+	}
+	return strings.TrimSuffix(p.Address, "/") + "/" + strings.Join(elements, "/"), nil
+}
+
+// parseSecretRef splits a reference of the form provider://path#key.
+func parseSecretRef(ref string) (provider, path, key string, err error) {
+	provider, rest, ok := strings.Cut(ref, "://")
+	if ok {
+		path, key, ok = strings.Cut(rest, "#")
+	}
+	if !ok || provider == "" || path == "" || key == "" {
+		return "", "", "", fmt.Errorf("secret reference %q is not of the form provider://path#key", ref)
+	}
+	return provider, path, key, nil
+}
+
+// secretProvider returns the SecretProvider registered under name. The
+// kubernetes provider is available unless replaced.
+func (r *MeshReconciler) secretProvider(name string) (SecretProvider, error) {
+	if provider, ok := r.SecretProviders[name]; ok {
+		return provider, nil
+	}
+	if name == "kubernetes" {
+		return &KubernetesSecretProvider{Client: r.Client}, nil
+	}
+	return nil, fmt.Errorf("unknown secret provider %q", name)
+}
+
+// readExternalSecrets reads the external secrets of a component into secret.
+func (r *MeshReconciler) readExternalSecrets(ctx context.Context, log logr.Logger, instance *v1beta1.Mesh, component string, secret *corev1.Secret) error {
+	for _, external := range render.ComponentSpec(instance, component).ExternalSecrets {
+		if _, ok := secret.Data[external.Key]; ok {
+			return &componentError{component, reasonSecretFetchFailed, fmt.Errorf("%s: key is also generated", external.Key)}
+		}
+		value, err := r.readExternalSecret(ctx, instance.Namespace, external.Ref)
+		if err != nil {
+			log.Error(err, "Failed to read external secret", "component", component, "key", external.Key)
+			return &componentError{component, reasonSecretFetchFailed, fmt.Errorf("%s: %w", external.Key, err)}
+		}
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[external.Key] = value
+	}
+	return nil
+}
+
+func (r *MeshReconciler) readExternalSecret(ctx context.Context, namespace, ref string) ([]byte, error) {
+	name, path, key, err := parseSecretRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := r.secretProvider(name)
+	if err != nil {
+		return nil, err
+	}
+	return provider.GetSecret(ctx, namespace, path, key)
+}
+
+// hasExternalSecrets reports whether a component of instance reads values
+// from a secret store.
+func hasExternalSecrets(instance *v1beta1.Mesh) bool {
+	for _, name := range render.ComponentNames {
+		if len(render.ComponentSpec(instance, name).ExternalSecrets) > 0 {
+			return true
+		}
+	}
+	return false
+}
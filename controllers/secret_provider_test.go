@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+// vaultStandIn serves the KV version 2 secrets of a mount named secret to
+// requests with the token root.
+type vaultStandIn struct {
+	mu      sync.Mutex
+	secrets map[string]map[string]interface{}
+}
+
+func (v *vaultStandIn) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("X-Vault-Token") != "root" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	data, ok := v.secrets[strings.TrimPrefix(req.URL.Path, "/v1/secret/data/")]
+	if !ok || !strings.HasPrefix(req.URL.Path, "/v1/secret/data/") {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"errors":[]}`))
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"data": map[string]interface{}{"data": data, "metadata": map[string]interface{}{"version": 1}},
+	})
+}
+
+func (v *vaultStandIn) set(path, key string, value interface{}) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.secrets[path][key] = value
+}
+
+func TestVaultSecretProvider(t *testing.T) {
+	ctx := context.Background()
+	vault := &vaultStandIn{secrets: map[string]map[string]interface{}{
+		"mesh/default/db":    {"password": "s3cret", "port": 5432},
+		"mesh/other/db":      {"password": "other"},
+		"mesh/default/a/b/c": {"password": "nested"},
+	}}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+	provider := &VaultSecretProvider{Address: server.URL, Token: "root", PathPrefix: "mesh"}
+
+	for _, test := range []struct {
+		path, key string
+		want      string
+		err       string
+	}{
+		{path: "secret/db", key: "password", want: "s3cret"},
+		{path: "secret/db", key: "port", want: "5432"},
+		{path: "secret/db", key: "user", err: "no key user"},
+		{path: "secret/missing", key: "password", err: "not found"},
+		{path: "secret/a/b/c", key: "password", want: "nested"},
+		{path: "secret", key: "password", err: "not of the form"},
+		{path: "secret/../other/db", key: "password", err: "leaves the secrets of namespace default"},
+		{path: "secret/a//c", key: "password", err: "leaves the secrets of namespace default"},
+		{path: "secret/%2e%2e/other/db", key: "password", err: "not found"},
+	} {
+		value, err := provider.GetSecret(ctx, "default", test.path, test.key)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%s#%s: got error %v, want %q", test.path, test.key, err, test.err)
+			}
+			continue
+		}
+		if err != nil || string(value) != test.want {
+			t.Errorf("%s#%s: got %q, %v, want %q", test.path, test.key, value, err, test.want)
+		}
+	}
+
+	// The same path reads the secret of the Mesh's namespace.
+	if value, err := provider.GetSecret(ctx, "other", "secret/db", "password"); err != nil || string(value) != "other" {
+		t.Errorf("secret/db#password in namespace other: got %q, %v, want other", value, err)
+	}
+
+	provider.Token = "wrong"
+	if _, err := provider.GetSecret(ctx, "default", "secret/db", "password"); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("wrong token: got %v, want permission denied", err)
+	}
+}
+
+func TestKubernetesSecretProvider(t *testing.T) {
+	ctx := context.Background()
+	mesh := newTestMesh()
+	optIn := map[string]string{v1beta1.ExternalSecretLabel: "true"}
+	r := newTestReconciler(t,
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "db-credentials", Namespace: mesh.Namespace, Labels: optIn},
+			Data:       map[string][]byte{"user": []byte("mesh")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "other-app", Namespace: mesh.Namespace},
+			Data:       map[string][]byte{"token": []byte("other")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: mesh.Name + "-ca", Namespace: mesh.Namespace, Labels: optIn,
+				OwnerReferences: []metav1.OwnerReference{*metav1.NewControllerRef(mesh, v1beta1.GroupVersion.WithKind("Mesh"))},
+			},
+			Data: map[string][]byte{corev1.TLSPrivateKeyKey: []byte("key")},
+		},
+	)
+	provider := &KubernetesSecretProvider{Client: r.Client}
+
+	if value, err := provider.GetSecret(ctx, mesh.Namespace, "db-credentials", "user"); err != nil || string(value) != "mesh" {
+		t.Errorf("labelled Secret: got %q, %v", value, err)
+	}
+	for _, path := range []string{"other-app", mesh.Name + "-ca"} {
+		if _, err := provider.GetSecret(ctx, mesh.Namespace, path, corev1.TLSPrivateKeyKey); err == nil {
+			t.Errorf("read Secret %s", path)
+		}
+	}
+}
+
+func TestReconcileExternalSecrets(t *testing.T) {
+	ctx := context.Background()
+	vault := &vaultStandIn{secrets: map[string]map[string]interface{}{"default/db": {"password": "one"}}}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	mesh := newTestMesh()
+	mesh.Spec.Components.Backend.ExternalSecrets = []v1beta1.ExternalSecret{
+		{Key: "db-password", Ref: "vault://secret/db#password"},
+		{Key: "db-user", Ref: "kubernetes://db-credentials#user"},
+	}
+	credentials := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "db-credentials", Namespace: mesh.Namespace,
+			Labels: map[string]string{v1beta1.ExternalSecretLabel: "true"},
+		},
+		Data: map[string][]byte{"user": []byte("mesh")},
+	}
+	r := newTestReconciler(t, mesh, credentials)
+	r.SecretProviders = map[string]SecretProvider{"vault": &VaultSecretProvider{Address: server.URL, Token: "root"}}
+	r.SecretRefreshInterval = time.Minute
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}}
+	key := types.NamespacedName{Name: "backend-secrets", Namespace: mesh.Namespace}
+
+	result, err := r.Reconcile(ctx, request)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if result.RequeueAfter != time.Minute {
+		t.Errorf("RequeueAfter: got %v, want the refresh interval", result.RequeueAfter)
+	}
+	secret := &corev1.Secret{}
+	if err := r.Client.Get(ctx, key, secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data["db-password"]) != "one" || string(secret.Data["db-user"]) != "mesh" {
+		t.Errorf("external secrets: got %v", secret.Data)
+	}
+	before := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: render.Backend, Namespace: mesh.Namespace}, before); err != nil {
+		t.Fatal(err)
+	}
+
+	// A refresh picks up the new value and restarts the component.
+	vault.set("default/db", "password", "two")
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := r.Client.Get(ctx, key, secret); err != nil {
+		t.Fatal(err)
+	}
+	if string(secret.Data["db-password"]) != "two" {
+		t.Errorf("refreshed password: got %q, want two", secret.Data["db-password"])
+	}
+	after := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: render.Backend, Namespace: mesh.Namespace}, after); err != nil {
+		t.Fatal(err)
+	}
+	if after.Spec.Template.Annotations[secretsHashAnnotation] == before.Spec.Template.Annotations[secretsHashAnnotation] {
+		t.Errorf("backend was not restarted after its external secret changed")
+	}
+
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	mesh.Spec.Components.Backend.ExternalSecrets[0].Ref = "aws://db#password"
+	if err := r.Client.Update(ctx, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err == nil {
+		t.Fatalf("Reconcile succeeded with an unknown secret provider")
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if mesh.Status.Components[1].Reason != reasonSecretFetchFailed {
+		t.Errorf("backend reason: got %q, want %s", mesh.Status.Components[1].Reason, reasonSecretFetchFailed)
+	}
+}
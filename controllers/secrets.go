@@ -0,0 +1,502 @@
+package controllers
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	logr "github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+const (
+	// generatedAtAnnotation, followed by the key of a generated value, is
+	// the annotation of a component's Secret that records when the value
+	// was generated.
+	generatedAtAnnotation = "generated.mesh.com/"
+
+	// rotationTriggerAnnotation records on a component's Secret the last
+	// value of the Mesh's RotateSecretsAnnotation that was acted on.
+	rotationTriggerAnnotation = "mesh.com/rotation-trigger"
+
+	// previousSuffix is appended to the keys of a rotated value to keep the
+	// previous value available during the grace period of its rotation.
+	previousSuffix = ".previous"
+
+	defaultPasswordLength  = 32
+	defaultPasswordCharset = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	defaultValidity        = 365 * 24 * time.Hour
+	caValidity             = 10 * 365 * 24 * time.Hour
+)
+
+// certificateAuthority is the CA that signs the certificates of a Mesh
+// issued by CertificateIssuerCA.
+type certificateAuthority struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	certPEM []byte
+}
+
+// generateSecret returns the Secret of a component with its generated values.
+// Values already in the Secret are kept until they are due for rotation or
+// the Mesh requests a rotation; missing ones are generated. Rotated values
+// stay available under previousSuffix keys for their grace period. ca signs
+// certificates issued by the Mesh CA and may be nil if no component uses it.
+func (r *MeshReconciler) generateSecret(ctx context.Context, log logr.Logger, instance *v1beta1.Mesh, component string, ca *certificateAuthority) (*corev1.Secret, error) {
+	secret := render.Secret(instance.Namespace, component)
+	spec := render.ComponentSpec(instance, component)
+	if len(spec.GeneratedSecrets) == 0 {
+		return secret, nil
+	}
+
+	current := &corev1.Secret{}
+	err := r.apiReader().Get(ctx, types.NamespacedName{Name: secret.Name, Namespace: secret.Namespace}, current)
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, &componentError{component, reasonGetFailed, err}
+	}
+
+	secret.Data = map[string][]byte{}
+	secret.Annotations = map[string]string{}
+	now := time.Now()
+	trigger := instance.Annotations[v1beta1.RotateSecretsAnnotation]
+	triggered := trigger != "" && trigger != current.Annotations[rotationTriggerAnnotation]
+	for _, generated := range spec.GeneratedSecrets {
+		annotation := generatedAtAnnotation + generated.Key
+		values, generatedAt := currentValues(current, generated)
+		next := nextRotation(generated, generatedAt, values)
+		due := values == nil || (!next.IsZero() && !now.Before(next)) || (triggered && generated.Rotation != nil)
+		if !due && now.Before(previousUntil(generated, generatedAt)) {
+			for _, key := range generatedKeys(generated) {
+				if value, ok := current.Data[key+previousSuffix]; ok {
+					secret.Data[key+previousSuffix] = value
+				}
+			}
+		}
+		if due {
+			fresh, err := generateValues(instance, component, generated, ca)
+			if err != nil {
+				log.Error(err, "Failed to generate secret", "component", component, "key", generated.Key)
+				return nil, &componentError{component, reasonSecretGenerationFailed, fmt.Errorf("%s: %w", generated.Key, err)}
+			}
+			reason, verb := reasonSecretGenerated, "Generated"
+			if values != nil {
+				reason, verb = reasonSecretRotated, "Rotated"
+				if previousUntil(generated, now).After(now) {
+					for key, value := range values {
+						secret.Data[key+previousSuffix] = value
+					}
+				}
+			}
+			log.Info(verb+" secret", "component", component, "key", generated.Key)
+			r.Recorder.Eventf(instance, corev1.EventTypeNormal, reason, "%s %s in Secret %s", verb, generated.Key, secret.Name)
+			values, generatedAt = fresh, now
+		}
+		for key, value := range values {
+			secret.Data[key] = value
+		}
+		secret.Annotations[annotation] = generatedAt.UTC().Format(time.RFC3339)
+	}
+	if trigger != "" {
+		secret.Annotations[rotationTriggerAnnotation] = trigger
+	}
+	return secret, nil
+}
+
+// previousUntil returns until when the previous value of generated, rotated
+// at rotatedAt, is kept.
+func previousUntil(generated v1beta1.GeneratedSecret, rotatedAt time.Time) time.Time {
+	if generated.Rotation == nil || generated.Rotation.GracePeriod == nil {
+		return time.Time{}
+	}
+	return rotatedAt.Add(generated.Rotation.GracePeriod.Duration)
+}
+
+// currentValues returns the values of generated in secret and when they were
+// generated, or nil if any of them is missing.
+func currentValues(secret *corev1.Secret, generated v1beta1.GeneratedSecret) (map[string][]byte, time.Time) {
+	generatedAt, err := time.Parse(time.RFC3339, secret.Annotations[generatedAtAnnotation+generated.Key])
+	if err != nil {
+		return nil, time.Time{}
+	}
+	values := map[string][]byte{}
+	for _, key := range generatedKeys(generated) {
+		value, ok := secret.Data[key]
+		if !ok {
+			return nil, time.Time{}
+		}
+		values[key] = value
+	}
+	return values, generatedAt
+}
+
+// generatedKeys returns the keys of the Secret data generated holds.
+func generatedKeys(generated v1beta1.GeneratedSecret) []string {
+	switch {
+	case generated.KeyPair != nil:
+		return []string{generated.Key + ".key", generated.Key + ".pub"}
+	case generated.Certificate != nil:
+		return []string{generated.Key + ".crt", generated.Key + ".key", generated.Key + ".ca.crt"}
+	default:
+		return []string{generated.Key}
+	}
+}
+
+// nextRotation returns when values, generated at generatedAt, are next due
+// to be generated again: at the end of their rotation interval or, for a
+// certificate, when a third of its validity is left. It returns the zero
+// time if they are never due.
+func nextRotation(generated v1beta1.GeneratedSecret, generatedAt time.Time, values map[string][]byte) time.Time {
+	var next time.Time
+	if generated.Rotation != nil && generated.Rotation.Interval != nil {
+		next = generatedAt.Add(generated.Rotation.Interval.Duration)
+	}
+	if generated.Certificate != nil {
+		if block, _ := pem.Decode(values[generated.Key+".crt"]); block != nil {
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+				renew := cert.NotAfter.Add(-cert.NotAfter.Sub(cert.NotBefore) / 3)
+				if next.IsZero() || renew.Before(next) {
+					next = renew
+				}
+			}
+		}
+	}
+	return next
+}
+
+// untilSecretRotation returns how long it is until the next generated value
+// of instance is due for rotation or its previous value is to be dropped, or
+// zero if none is.
+func (r *MeshReconciler) untilSecretRotation(ctx context.Context, instance *v1beta1.Mesh) time.Duration {
+	var until time.Duration
+	for _, name := range render.ComponentNames {
+		spec := render.ComponentSpec(instance, name)
+		if len(spec.GeneratedSecrets) == 0 {
+			continue
+		}
+		secret := &corev1.Secret{}
+		if err := r.Client.Get(ctx, types.NamespacedName{Name: name + "-secrets", Namespace: instance.Namespace}, secret); err != nil {
+			continue
+		}
+		for _, generated := range spec.GeneratedSecrets {
+			values, generatedAt := currentValues(secret, generated)
+			next := nextRotation(generated, generatedAt, values)
+			if _, ok := secret.Data[generatedKeys(generated)[0]+previousSuffix]; ok {
+				if until := previousUntil(generated, generatedAt); next.IsZero() || until.Before(next) {
+					next = until
+				}
+			}
+			if values == nil || next.IsZero() {
+				continue
+			}
+			d := time.Until(next)
+			if d < time.Second {
+				d = time.Second
+			}
+			until = sooner(until, d)
+		}
+	}
+	return until
+}
+
+// generateValues generates the values of generated for a component.
+func generateValues(instance *v1beta1.Mesh, component string, generated v1beta1.GeneratedSecret, ca *certificateAuthority) (map[string][]byte, error) {
+	set := 0
+	for _, generator := range []bool{generated.Password != nil, generated.KeyPair != nil, generated.Certificate != nil} {
+		if generator {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("exactly one of password, keyPair and certificate must be set")
+	}
+
+	switch {
+	case generated.Password != nil:
+		password, err := generatePassword(generated.Password)
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{generated.Key: password}, nil
+	case generated.KeyPair != nil:
+		key, err := generateKey(*generated.KeyPair)
+		if err != nil {
+			return nil, err
+		}
+		keyPEM, pubPEM, err := encodeKeyPair(key)
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{generated.Key + ".key": keyPEM, generated.Key + ".pub": pubPEM}, nil
+	default:
+		if generated.Certificate.Issuer != v1beta1.CertificateIssuerSelfSigned && ca == nil {
+			return nil, fmt.Errorf("no CA to issue the certificate")
+		}
+		if generated.Certificate.Issuer == v1beta1.CertificateIssuerSelfSigned {
+			ca = nil
+		}
+		certPEM, keyPEM, caPEM, err := generateCertificate(generated.Certificate, ca)
+		if err != nil {
+			return nil, err
+		}
+		return map[string][]byte{
+			generated.Key + ".crt":    certPEM,
+			generated.Key + ".key":    keyPEM,
+			generated.Key + ".ca.crt": caPEM,
+		}, nil
+	}
+}
+
+// generatePassword returns a random password of the configured length, made
+// of characters of the configured charset.
+func generatePassword(generator *v1beta1.PasswordGenerator) ([]byte, error) {
+	length := int(generator.Length)
+	if length == 0 {
+		length = defaultPasswordLength
+	}
+	charset := []rune(generator.Charset)
+	if len(charset) == 0 {
+		charset = []rune(defaultPasswordCharset)
+	}
+	password := make([]rune, length)
+	for i := range password {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+		if err != nil {
+			return nil, err
+		}
+		password[i] = charset[n.Int64()]
+	}
+	return []byte(string(password)), nil
+}
+
+// generateKey returns a new private key.
+func generateKey(generator v1beta1.KeyPairGenerator) (crypto.Signer, error) {
+	switch generator.Algorithm {
+	case v1beta1.KeyAlgorithmRSA:
+		size := int(generator.Size)
+		if size == 0 {
+			size = 2048
+		}
+		if size < 2048 {
+			return nil, fmt.Errorf("RSA keys must have at least 2048 bits")
+		}
+		return rsa.GenerateKey(rand.Reader, size)
+	case v1beta1.KeyAlgorithmECDSA, "":
+		var curve elliptic.Curve
+		switch generator.Size {
+		case 0, 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported ECDSA key size %d", generator.Size)
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm %s", generator.Algorithm)
+	}
+}
+
+// encodeKeyPair returns key as a PEM encoded PKCS #8 private key and its
+// PEM encoded public key.
+func encodeKeyPair(key crypto.Signer) ([]byte, []byte, error) {
+	private, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	public, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: private}),
+		pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}), nil
+}
+
+// generateCertificate returns a serving certificate for the DNS names of
+// generator, its private key and the certificate of its issuer, all PEM
+// encoded. The certificate is self-signed when ca is nil.
+func generateCertificate(generator *v1beta1.CertificateGenerator, ca *certificateAuthority) ([]byte, []byte, []byte, error) {
+	if len(generator.DNSNames) == 0 {
+		return nil, nil, nil, fmt.Errorf("certificate has no dnsNames")
+	}
+	key, err := generateKey(generator.KeyPair)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	validity := defaultValidity
+	if generator.Validity != nil {
+		validity = generator.Validity.Duration
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: generator.DNSNames[0]},
+		DNSNames:     generator.DNSNames,
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+
+	parent, signer := template, key
+	if ca != nil {
+		parent, signer = ca.cert, ca.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	keyPEM, _, err := encodeKeyPair(key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	caPEM := certPEM
+	if ca != nil {
+		caPEM = ca.certPEM
+	}
+	return certPEM, keyPEM, caPEM, nil
+}
+
+// usesCA reports whether a component has a certificate issued by the Mesh CA.
+func usesCA(spec v1beta1.ComponentSpec) bool {
+	for _, generated := range spec.GeneratedSecrets {
+		if generated.Certificate != nil && generated.Certificate.Issuer != v1beta1.CertificateIssuerSelfSigned {
+			return true
+		}
+	}
+	return false
+}
+
+// usesMeshCA reports whether a component of instance has a certificate
+// issued by the Mesh CA.
+func usesMeshCA(instance *v1beta1.Mesh) bool {
+	for _, name := range render.ComponentNames {
+		spec := render.ComponentSpec(instance, name)
+		if !spec.Paused && spec.Source == nil && usesCA(spec) {
+			return true
+		}
+	}
+	return false
+}
+
+// meshCA returns the CA of a Mesh, kept in the Secret <mesh>-ca. The CA is
+// created with the Secret and never changed afterwards, so that certificates
+// it issued stay trusted.
+func (r *MeshReconciler) meshCA(ctx context.Context, log logr.Logger, instance *v1beta1.Mesh) (*certificateAuthority, error) {
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Name: instance.Name + "-ca", Namespace: instance.Namespace}
+	err := r.apiReader().Get(ctx, key, secret)
+	if err == nil {
+		return parseCA(secret)
+	}
+	if !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	caKey, err := generateKey(v1beta1.KeyPairGenerator{})
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: instance.Name + "." + instance.Namespace + " CA"},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, caKey.Public(), caKey)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, _, err := encodeKeyPair(caKey)
+	if err != nil {
+		return nil, err
+	}
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace},
+		Type:       corev1.SecretTypeTLS,
+		Data: map[string][]byte{
+			corev1.TLSCertKey:       pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+			corev1.TLSPrivateKeyKey: keyPEM,
+		},
+	}
+	if err := controllerutil.SetControllerReference(instance, secret, r.Scheme); err != nil {
+		return nil, err
+	}
+	if err := r.Client.Create(ctx, secret); errors.IsAlreadyExists(err) {
+		// Another reconcile created the CA since it was read; keep that one.
+		if err := r.apiReader().Get(ctx, key, secret); err != nil {
+			return nil, err
+		}
+		return parseCA(secret)
+	} else if err != nil {
+		return nil, err
+	}
+	log.Info("Created Mesh CA", "Secret.Name", secret.Name)
+	r.Recorder.Eventf(instance, corev1.EventTypeNormal, reasonCreated, "Created CA Secret %s", secret.Name)
+	return parseCA(secret)
+}
+
+// apiReader returns the reader of objects that must not be read from a stale
+// cache.
+func (r *MeshReconciler) apiReader() client.Reader {
+	if r.APIReader != nil {
+		return r.APIReader
+	}
+	return r.Client
+}
+
+// parseCA reads a CA from a TLS Secret.
+func parseCA(secret *corev1.Secret) (*certificateAuthority, error) {
+	block, _ := pem.Decode(secret.Data[corev1.TLSCertKey])
+	if block == nil {
+		return nil, fmt.Errorf("secret %s holds no CA certificate", secret.Name)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	keyBlock, _ := pem.Decode(secret.Data[corev1.TLSPrivateKeyKey])
+	if keyBlock == nil {
+		return nil, fmt.Errorf("secret %s holds no CA key", secret.Name)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("secret %s holds an unsupported CA key", secret.Name)
+	}
+	return &certificateAuthority{cert: cert, key: signer, certPEM: secret.Data[corev1.TLSCertKey]}, nil
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+// parseCertificate decodes a PEM encoded certificate.
+func parseCertificate(t *testing.T, data []byte) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode(data)
+	if block == nil {
+		t.Fatalf("no PEM block in %q", data)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestReconcileGeneratedSecrets(t *testing.T) {
+	ctx := context.Background()
+	mesh := newTestMesh()
+	mesh.Spec.Components.Backend.GeneratedSecrets = []v1beta1.GeneratedSecret{
+		{
+			Key:      "password",
+			Password: &v1beta1.PasswordGenerator{Length: 20, Charset: "ab"},
+			Rotation: &v1beta1.SecretRotation{Interval: &metav1.Duration{Duration: time.Hour}},
+		},
+		{Key: "signing", KeyPair: &v1beta1.KeyPairGenerator{}},
+		{Key: "tls", Certificate: &v1beta1.CertificateGenerator{DNSNames: []string{"backend.default.svc"}}},
+		{Key: "peer", Certificate: &v1beta1.CertificateGenerator{Issuer: v1beta1.CertificateIssuerSelfSigned, DNSNames: []string{"backend.default.svc"}}},
+	}
+	r := newTestReconciler(t, mesh)
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}}
+
+	result, err := r.Reconcile(ctx, request)
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if result.RequeueAfter <= 0 || result.RequeueAfter > time.Hour {
+		t.Errorf("RequeueAfter: got %v, want the time until the password rotation", result.RequeueAfter)
+	}
+	secret := &corev1.Secret{}
+	key := types.NamespacedName{Name: "backend-secrets", Namespace: mesh.Namespace}
+	if err := r.Client.Get(ctx, key, secret); err != nil {
+		t.Fatal(err)
+	}
+	if password := string(secret.Data["password"]); len(password) != 20 || strings.Trim(password, "ab") != "" {
+		t.Errorf("password %q does not have 20 characters of the charset", password)
+	}
+	if _, ok := secret.Data["signing.pub"]; !ok {
+		t.Errorf("key pair was not generated: %v", secret.Data)
+	}
+
+	ca := &corev1.Secret{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: mesh.Name + "-ca", Namespace: mesh.Namespace}, ca); err != nil {
+		t.Fatalf("Mesh CA: %v", err)
+	}
+	if !bytes.Equal(ca.Data[corev1.TLSCertKey], secret.Data["tls.ca.crt"]) {
+		t.Errorf("tls.ca.crt is not the Mesh CA")
+	}
+	for _, name := range []string{"tls", "peer"} {
+		roots := x509.NewCertPool()
+		roots.AddCert(parseCertificate(t, secret.Data[name+".ca.crt"]))
+		_, err := parseCertificate(t, secret.Data[name+".crt"]).Verify(x509.VerifyOptions{
+			DNSName: "backend.default.svc",
+			Roots:   roots,
+		})
+		if err != nil {
+			t.Errorf("%s certificate: %v", name, err)
+		}
+		if names := parseCertificate(t, secret.Data[name+".crt"]).DNSNames; len(names) != 1 {
+			t.Errorf("%s certificate: got DNS names %v, want only backend.default.svc", name, names)
+		}
+	}
+
+	// The generated values are stable until the password is due.
+	before := secret.DeepCopy()
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := r.Client.Get(ctx, key, secret); err != nil {
+		t.Fatal(err)
+	}
+	if secret.ResourceVersion != before.ResourceVersion {
+		t.Errorf("generated values changed on a second reconcile")
+	}
+
+	secret.Annotations[generatedAtAnnotation+"password"] = time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	if err := r.Client.Update(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := r.Client.Get(ctx, key, secret); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(secret.Data["password"], before.Data["password"]) {
+		t.Errorf("password was not rotated")
+	}
+	if !bytes.Equal(secret.Data["signing.key"], before.Data["signing.key"]) {
+		t.Errorf("key pair without rotation was regenerated")
+	}
+}
+
+func TestGeneratedSecretsSurviveCacheMiss(t *testing.T) {
+	ctx := context.Background()
+	mesh := newTestMesh()
+	mesh.Spec.Components.Backend.GeneratedSecrets = []v1beta1.GeneratedSecret{
+		{Key: "password", Password: &v1beta1.PasswordGenerator{}},
+		{Key: "tls", Certificate: &v1beta1.CertificateGenerator{DNSNames: []string{"backend.default.svc"}}},
+	}
+	r := newTestReconciler(t, mesh)
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	key := types.NamespacedName{Name: "backend-secrets", Namespace: mesh.Namespace}
+	before := &corev1.Secret{}
+	if err := r.Client.Get(ctx, key, before); err != nil {
+		t.Fatal(err)
+	}
+
+	// A cache that has not seen the Secrets yet reports them missing; the
+	// API server still has them.
+	r.APIReader = r.Client
+	r.Client = interceptor.NewClient(r.Client.(client.WithWatch), interceptor.Funcs{
+		Get: func(ctx context.Context, c client.WithWatch, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+			if _, ok := obj.(*corev1.Secret); ok {
+				return errors.NewNotFound(corev1.Resource("secrets"), key.Name)
+			}
+			return c.Get(ctx, key, obj, opts...)
+		},
+	})
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	after := &corev1.Secret{}
+	if err := r.APIReader.Get(ctx, key, after); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"password", "tls.crt", "tls.ca.crt"} {
+		if !bytes.Equal(after.Data[k], before.Data[k]) {
+			t.Errorf("%s was regenerated on a cache miss", k)
+		}
+	}
+}
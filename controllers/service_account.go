@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+
+	logr "github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+// pruneServiceAccount deletes the ServiceAccount, Role and RoleBinding of a
+// component that its spec no longer declares.
+func (r *MeshReconciler) pruneServiceAccount(ctx context.Context, log logr.Logger, instance *v1beta1.Mesh, component string) error {
+	stale, err := r.staleServiceAccount(ctx, instance, component)
+	if err != nil {
+		return &componentError{component, reasonPruneFailed, err}
+	}
+	for _, obj := range stale {
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		if err := r.Client.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+			log.Error(err, "Failed to prune "+kind, kind+".Name", component)
+			return &componentError{component, reasonPruneFailed, err}
+		}
+		log.Info("Pruned "+kind, kind+".Name", component)
+		r.Recorder.Eventf(instance, corev1.EventTypeNormal, reasonPruned,
+			"Deleted %s %s, which %s no longer declares", kind, component, component)
+	}
+	return nil
+}
+
+// staleServiceAccount returns the ServiceAccount, Role and RoleBinding of a
+// component that its spec no longer declares, in the order they are to be
+// deleted. Objects of the same name that the Mesh does not control are left
+// out.
+func (r *MeshReconciler) staleServiceAccount(ctx context.Context, instance *v1beta1.Mesh, component string) ([]client.Object, error) {
+	spec := render.ComponentSpec(instance, component).ServiceAccount
+	hasRules := spec != nil && len(spec.Rules) > 0
+	var stale []client.Object
+	for _, child := range []struct {
+		obj  client.Object
+		keep bool
+	}{
+		{&rbacv1.RoleBinding{}, hasRules},
+		{&rbacv1.Role{}, hasRules},
+		{&corev1.ServiceAccount{}, spec != nil},
+	} {
+		if child.keep {
+			continue
+		}
+		err := r.Client.Get(ctx, types.NamespacedName{Name: component, Namespace: instance.Namespace}, child.obj)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !metav1.IsControlledBy(child.obj, instance) {
+			continue
+		}
+		gvk, err := apiutil.GVKForObject(child.obj, r.Scheme)
+		if err != nil {
+			return nil, err
+		}
+		child.obj.GetObjectKind().SetGroupVersionKind(gvk)
+		stale = append(stale, child.obj)
+	}
+	return stale, nil
+}
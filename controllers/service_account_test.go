@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+func TestReconcileServiceAccount(t *testing.T) {
+	ctx := context.Background()
+	mesh := newTestMesh()
+	mesh.Spec.Components.Backend.ServiceAccount = &v1beta1.ComponentServiceAccount{
+		Rules: []rbacv1.PolicyRule{{
+			APIGroups: []string{""},
+			Resources: []string{"configmaps"},
+			Verbs:     []string{"get", "list", "watch"},
+		}},
+	}
+	r := newTestReconciler(t, mesh)
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}}
+	key := types.NamespacedName{Name: render.Backend, Namespace: mesh.Namespace}
+
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	account := &corev1.ServiceAccount{}
+	role := &rbacv1.Role{}
+	binding := &rbacv1.RoleBinding{}
+	for _, obj := range []client.Object{account, role, binding} {
+		if err := r.Client.Get(ctx, key, obj); err != nil {
+			t.Fatalf("%T: %v", obj, err)
+		}
+		if !metav1.IsControlledBy(obj, mesh) {
+			t.Errorf("%T is not controlled by the Mesh", obj)
+		}
+	}
+	if len(role.Rules) != 1 || role.Rules[0].Resources[0] != "configmaps" {
+		t.Errorf("Role rules: got %v", role.Rules)
+	}
+	if binding.RoleRef.Name != render.Backend || binding.Subjects[0].Name != render.Backend {
+		t.Errorf("RoleBinding does not bind the Role to the ServiceAccount: %v", binding)
+	}
+	deployment := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, key, deployment); err != nil {
+		t.Fatal(err)
+	}
+	if deployment.Spec.Template.Spec.ServiceAccountName != render.Backend {
+		t.Errorf("backend ServiceAccountName: got %q, want %s", deployment.Spec.Template.Spec.ServiceAccountName, render.Backend)
+	}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: render.Frontend, Namespace: mesh.Namespace}, &corev1.ServiceAccount{}); !errors.IsNotFound(err) {
+		t.Errorf("frontend without a ServiceAccount got one: %v", err)
+	}
+
+	// Dropping the rules prunes the Role and RoleBinding but keeps the
+	// ServiceAccount.
+	mesh.Spec.Components.Backend.ServiceAccount.Rules = nil
+	if err := r.Client.Update(ctx, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := r.Client.Get(ctx, key, &rbacv1.Role{}); !errors.IsNotFound(err) {
+		t.Errorf("Role was not pruned: %v", err)
+	}
+	if err := r.Client.Get(ctx, key, &rbacv1.RoleBinding{}); !errors.IsNotFound(err) {
+		t.Errorf("RoleBinding was not pruned: %v", err)
+	}
+	if err := r.Client.Get(ctx, key, &corev1.ServiceAccount{}); err != nil {
+		t.Errorf("ServiceAccount: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package controllers
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+// Shard is the subset of Meshes reconciled by one operator replica when
+// Meshes are partitioned across several replicas. The zero value owns every
+// Mesh.
+type Shard struct {
+	// ID is the shard of this replica, from 0 to Count-1.
+	ID int
+	// Count is the number of shards. Sharding is disabled when it is 0 or 1.
+	Count int
+}
+
+// Enabled reports whether Meshes are partitioned at all.
+func (s Shard) Enabled() bool {
+	return s.Count > 1
+}
+
+// Of returns the shard a Mesh belongs to: the value of its mesh.com/shard
+// label if it holds a valid shard number, otherwise a hash of its UID.
+func (s Shard) Of(obj client.Object) int {
+	if value, ok := obj.GetLabels()[v1beta1.ShardLabel]; ok {
+		if id, err := strconv.Atoi(value); err == nil && id >= 0 && id < s.Count {
+			return id
+		}
+	}
+	h := fnv.New32a()
+	h.Write([]byte(obj.GetUID()))
+	return int(h.Sum32() % uint32(s.Count))
+}
+
+// Owns reports whether obj belongs to this shard.
+func (s Shard) Owns(obj client.Object) bool {
+	return !s.Enabled() || s.Of(obj) == s.ID
+}
@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+func TestShardOwns(t *testing.T) {
+	const count = 4
+	for i := 0; i < 100; i++ {
+		mesh := newTestMesh()
+		mesh.UID = types.UID(fmt.Sprintf("uid-%d", i))
+		owners := 0
+		for id := 0; id < count; id++ {
+			if (Shard{ID: id, Count: count}).Owns(mesh) {
+				owners++
+			}
+		}
+		if owners != 1 {
+			t.Fatalf("Mesh %s is owned by %d shards, want 1", mesh.UID, owners)
+		}
+	}
+
+	mesh := newTestMesh()
+	mesh.Labels = map[string]string{v1beta1.ShardLabel: "2"}
+	if got := (Shard{Count: count}).Of(mesh); got != 2 {
+		t.Errorf("labelled Mesh: got shard %d, want 2", got)
+	}
+	if !(Shard{}).Owns(mesh) {
+		t.Errorf("unsharded reconciler does not own the Mesh")
+	}
+}
+
+func TestReconcileOtherShard(t *testing.T) {
+	ctx := context.Background()
+	mesh := newTestMesh()
+	mesh.Labels = map[string]string{v1beta1.ShardLabel: "1"}
+	r := newTestReconciler(t, mesh)
+	r.Shard = Shard{ID: 0, Count: 2}
+
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "mesh-sample", Namespace: "default"}}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: render.Frontend, Namespace: "default"}, &appsv1.Deployment{})
+	if !errors.IsNotFound(err) {
+		t.Errorf("Mesh of another shard got a Deployment: %v", err)
+	}
+}
+
+func TestShardMove(t *testing.T) {
+	ctx := context.Background()
+	old := newTestMesh()
+	old.Labels = map[string]string{v1beta1.ShardLabel: "0"}
+	moved := old.DeepCopy()
+	moved.Labels[v1beta1.ShardLabel] = "1"
+	update := event.UpdateEvent{ObjectOld: old, ObjectNew: moved}
+	for id, want := range []bool{true, true, false} {
+		r := &MeshReconciler{Shard: Shard{ID: id, Count: 3}}
+		if got := r.meshPredicate().Update(update); got != want {
+			t.Errorf("shard %d: got %v for a Mesh moved from shard 0 to 1, want %v", id, got, want)
+		}
+	}
+
+	// The shard the Mesh left drops its series.
+	r := newTestReconciler(t, moved)
+	r.Shard = Shard{ID: 0, Count: 3}
+	recordMeshMetrics(old, v1beta1.MeshStatus{}, v1beta1.MeshStatus{Components: []v1beta1.ComponentStatus{{Name: render.Frontend}}})
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: "mesh-sample", Namespace: "default"}}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if componentReadyReplicas.DeleteLabelValues("default", "mesh-sample", render.Frontend) {
+		t.Errorf("shard 0 still exports the ready replicas of a Mesh it no longer owns")
+	}
+}
@@ -0,0 +1,149 @@
+package controllers
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/remote/transport"
+)
+
+const (
+	// cosignSignatureAnnotation holds the base64 encoded signature of a
+	// layer of a cosign signature image.
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	// cosignSignatureType is the type of a cosign simple signing payload.
+	cosignSignatureType = "cosign container image signature"
+
+	// maxSignaturePayload bounds the size of a signature payload read from
+	// a registry.
+	maxSignaturePayload = 1 << 20
+)
+
+// simpleSigningPayload is the part of a cosign simple signing payload that
+// is verified.
+type simpleSigningPayload struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// ParseSignatureKeys parses the PEM encoded public keys in data, such as a
+// file of cosign public keys.
+func ParseSignatureKeys(data []byte) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("signature key %d: %w", len(keys)+1, err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no PEM encoded public key found")
+	}
+	return keys, nil
+}
+
+// verifySignature checks that digest has a cosign signature made with one of
+// keys. Signatures are read from the repository of digest, under the tag
+// cosign stores them at.
+func verifySignature(digest name.Digest, keys []crypto.PublicKey, options ...remote.Option) error {
+	tag := digest.Context().Tag(strings.Replace(digest.DigestStr(), ":", "-", 1) + ".sig")
+	signatures, err := remote.Image(tag, options...)
+	var terr *transport.Error
+	if errors.As(err, &terr) && terr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("image %s is not signed", digest)
+	}
+	if err != nil {
+		return fmt.Errorf("reading signatures of %s: %w", digest, err)
+	}
+	manifest, err := signatures.Manifest()
+	if err != nil {
+		return fmt.Errorf("reading signatures of %s: %w", digest, err)
+	}
+
+	for _, layer := range manifest.Layers {
+		signature, err := base64.StdEncoding.DecodeString(layer.Annotations[cosignSignatureAnnotation])
+		if err != nil || len(signature) == 0 {
+			continue
+		}
+		blob, err := signatures.LayerByDigest(layer.Digest)
+		if err != nil {
+			return err
+		}
+		payload, err := readPayload(blob.Compressed)
+		if err != nil {
+			return fmt.Errorf("reading signature payload of %s: %w", digest, err)
+		}
+
+		var signed simpleSigningPayload
+		if err := json.Unmarshal(payload, &signed); err != nil ||
+			signed.Critical.Type != cosignSignatureType ||
+			signed.Critical.Image.DockerManifestDigest != digest.DigestStr() {
+			continue
+		}
+		for _, key := range keys {
+			if verifyPayload(key, payload, signature) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("no signature of image %s was made with a trusted key", digest)
+}
+
+// readPayload reads a signature payload, refusing payloads larger than
+// maxSignaturePayload.
+func readPayload(open func() (io.ReadCloser, error)) ([]byte, error) {
+	rc, err := open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	payload, err := io.ReadAll(io.LimitReader(rc, maxSignaturePayload+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > maxSignaturePayload {
+		return nil, fmt.Errorf("payload exceeds %d bytes", maxSignaturePayload)
+	}
+	return payload, nil
+}
+
+// verifyPayload reports whether signature is a signature of payload made
+// with key, the way cosign signs with keys of its type.
+func verifyPayload(key crypto.PublicKey, payload, signature []byte) bool {
+	digest := sha256.Sum256(payload)
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, payload, signature)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,196 @@
+package controllers
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+// headDigest returns the digest of image in the registry.
+func headDigest(t *testing.T, image string) name.Digest {
+	t.Helper()
+	ref, err := name.ParseReference(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	descriptor, err := remote.Head(ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ref.Context().Digest(descriptor.Digest.String())
+}
+
+// sign pushes a cosign signature of digest made with key.
+func sign(t *testing.T, digest name.Digest, key *ecdsa.PrivateKey) {
+	t.Helper()
+	payload := []byte(`{"critical":{"identity":{"docker-reference":"` + digest.Context().Name() +
+		`"},"image":{"docker-manifest-digest":"` + digest.DigestStr() +
+		`"},"type":"cosign container image signature"},"optional":null}`)
+	hash := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, err := mutate.Append(empty.Image, mutate.Addendum{
+		Layer:       static.NewLayer(payload, types.MediaType("application/vnd.dev.cosign.simplesigning.v1+json")),
+		Annotations: map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(signature)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag := digest.Context().Tag(strings.Replace(digest.DigestStr(), ":", "-", 1) + ".sig")
+	if err := remote.Write(tag, image); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newSigningKey returns a new key and its PEM encoded public key.
+func newSigningKey(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestReconcileSignatureVerification(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	trusted, trustedPEM := newSigningKey(t)
+	untrusted, _ := newSigningKey(t)
+	keys, err := ParseSignatureKeys(trustedPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mesh := newTestMesh()
+	digests := map[string]name.Digest{}
+	for _, component := range render.ComponentNames {
+		pushTags(t, host, component, "1.0")
+		digests[component] = headDigest(t, host+"/"+component+":1.0")
+		render.ComponentSpecRef(mesh, component).Image = host + "/" + component + ":1.0"
+	}
+	sign(t, digests[render.Frontend], trusted)
+	sign(t, digests[render.Backend], trusted)
+	sign(t, digests[render.App], untrusted)
+	r := newTestReconciler(t, mesh)
+	r.SignatureKeys = keys
+	request := reconcile.Request{NamespacedName: k8stypes.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}}
+
+	if _, err := r.Reconcile(ctx, request); err == nil {
+		t.Fatalf("Reconcile succeeded with an image signed by an untrusted key")
+	}
+	deployment := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, k8stypes.NamespacedName{Name: render.Backend, Namespace: mesh.Namespace}, deployment); err != nil {
+		t.Fatal(err)
+	}
+	if want := host + "/backend:1.0@" + digests[render.Backend].DigestStr(); deployment.Spec.Template.Spec.Containers[0].Image != want {
+		t.Errorf("verified image: got %s, want it deployed by digest as %s", deployment.Spec.Template.Spec.Containers[0].Image, want)
+	}
+	if err := r.Client.Get(ctx, k8stypes.NamespacedName{Name: render.App, Namespace: mesh.Namespace}, &appsv1.Deployment{}); err == nil {
+		t.Errorf("Deployment was created for an image signed by an untrusted key")
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if mesh.Status.Components[2].Reason != reasonSignatureVerificationFailed {
+		t.Errorf("app reason: got %q, want %s", mesh.Status.Components[2].Reason, reasonSignatureVerificationFailed)
+	}
+	if !meta.IsStatusConditionFalse(mesh.Status.Conditions, v1beta1.ConditionImagesVerified) {
+		t.Errorf("ImagesVerified condition is not False: %v", mesh.Status.Conditions)
+	}
+
+	sign(t, digests[render.App], trusted)
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if !meta.IsStatusConditionTrue(mesh.Status.Conditions, v1beta1.ConditionImagesVerified) {
+		t.Errorf("ImagesVerified condition is not True: %v", mesh.Status.Conditions)
+	}
+
+	pushTags(t, host, "unsigned", "1.0")
+	err = verifySignature(headDigest(t, host+"/unsigned:1.0"), []crypto.PublicKey{trusted.Public()})
+	if err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Errorf("unsigned image: got %v, want it reported as not signed", err)
+	}
+}
+
+func TestResolveSourceImages(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(registry.New())
+	defer server.Close()
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	trusted, trustedPEM := newSigningKey(t)
+	keys, err := ParseSignatureKeys(trustedPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pushTags(t, host, "signed", "1.0")
+	pushTags(t, host, "unsigned", "1.0")
+	signed := headDigest(t, host+"/signed:1.0")
+	sign(t, signed, trusted)
+
+	mesh := newTestMesh()
+	r := newTestReconciler(t, mesh)
+	r.SignatureKeys = keys
+	deployment := func(image string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   map[string]interface{}{"name": render.Backend},
+			"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+				"containers": []interface{}{map[string]interface{}{"name": render.Backend, "image": image}},
+			}}},
+		}}
+	}
+
+	obj := deployment(host + "/signed:1.0")
+	if err := r.resolveSourceImages(ctx, r.Log, mesh, render.Backend, []*unstructured.Unstructured{obj}); err != nil {
+		t.Fatalf("signed image: %v", err)
+	}
+	containers, _, _ := unstructured.NestedSlice(obj.Object, "spec", "template", "spec", "containers")
+	if want := host + "/signed:1.0@" + signed.DigestStr(); containers[0].(map[string]interface{})["image"] != want {
+		t.Errorf("rendered image: got %v, want it deployed by digest as %s", containers[0], want)
+	}
+
+	err = r.resolveSourceImages(ctx, r.Log, mesh, render.Backend, []*unstructured.Unstructured{deployment(host + "/unsigned:1.0")})
+	if ce, ok := err.(*componentError); !ok || ce.reason != reasonSignatureVerificationFailed {
+		t.Errorf("unsigned image: got %v, want a %s error", err, reasonSignatureVerificationFailed)
+	}
+}
@@ -0,0 +1,138 @@
+package controllers
+
+import (
+	"context"
+
+	logr "github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+// reconcileSource renders a component from its source, applies the rendered
+// objects and deletes the objects applied from it before that it no longer
+// renders. It returns the objects now applied.
+func (r *MeshReconciler) reconcileSource(ctx context.Context, log logr.Logger, instance *v1beta1.Mesh, component string, source *v1beta1.ComponentSource) ([]v1beta1.RenderedObject, error) {
+	objects, err := r.renderSource(ctx, instance, component, source)
+	if err != nil {
+		log.Error(err, "Failed to render component source", "component", component)
+		return nil, err
+	}
+
+	if err := r.resolveSourceImages(ctx, log, instance, component, objects); err != nil {
+		return nil, err
+	}
+
+	children := make([]client.Object, 0, len(objects))
+	for _, obj := range objects {
+		children = append(children, obj)
+	}
+	if err := r.checkPolicy(ctx, log, instance, component, children); err != nil {
+		return nil, err
+	}
+
+	applied := make([]v1beta1.RenderedObject, 0, len(objects))
+	for _, obj := range objects {
+		if _, err := r.reconcileChild(ctx, log, instance, component, obj); err != nil {
+			return nil, err
+		}
+		applied = append(applied, v1beta1.RenderedObject{APIVersion: obj.GetAPIVersion(), Kind: obj.GetKind(), Name: obj.GetName()})
+	}
+
+	for _, previous := range staleRendered(instance, component, applied) {
+		if err := r.prune(ctx, log, instance, component, previous); err != nil {
+			return nil, err
+		}
+	}
+	return applied, nil
+}
+
+// renderSource renders the objects of component from its source. Charts are
+// pulled with the image pull secrets of the Mesh and kept in r.charts.
+func (r *MeshReconciler) renderSource(ctx context.Context, instance *v1beta1.Mesh, component string, source *v1beta1.ComponentSource) ([]*unstructured.Unstructured, error) {
+	opts := render.Options{SourceDir: r.SourceDir, Charts: &r.charts}
+	if source.Chart != nil && source.Chart.Ref != "" && instance.Spec.ImagePolicy != nil {
+		keychain, err := r.pullSecretKeychain(ctx, instance.Namespace, instance.Spec.ImagePolicy.ImagePullSecrets)
+		if err != nil {
+			return nil, &componentError{component, reasonRenderFailed, err}
+		}
+		opts.ChartKeychain = keychain
+	}
+	objects, err := render.Source(ctx, instance, component, source, opts)
+	if err != nil {
+		return nil, &componentError{component, reasonRenderFailed, err}
+	}
+	return objects, nil
+}
+
+// staleRendered returns the objects rendered from the source of component
+// when the Mesh was last reconciled that are not among rendered.
+func staleRendered(instance *v1beta1.Mesh, component string, rendered []v1beta1.RenderedObject) []v1beta1.RenderedObject {
+	var stale []v1beta1.RenderedObject
+	for _, previous := range previousRendered(instance, component) {
+		found := false
+		for _, current := range rendered {
+			if current == previous {
+				found = true
+			}
+		}
+		if !found {
+			stale = append(stale, previous)
+		}
+	}
+	return stale
+}
+
+// previousRendered returns the objects applied from the source of component
+// when the Mesh was last reconciled.
+func previousRendered(instance *v1beta1.Mesh, component string) []v1beta1.RenderedObject {
+	for _, status := range instance.Status.Components {
+		if status.Name == component {
+			return status.Rendered
+		}
+	}
+	return nil
+}
+
+// prune deletes an object that was rendered from the source of component,
+// unless it has since been taken over by another controller.
+func (r *MeshReconciler) prune(ctx context.Context, log logr.Logger, instance *v1beta1.Mesh, component string, ref v1beta1.RenderedObject) error {
+	obj, err := r.controlledRendered(ctx, instance, ref)
+	if err != nil {
+		return &componentError{component, reasonPruneFailed, err}
+	}
+	if obj == nil {
+		return nil
+	}
+
+	if err := r.Client.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+		log.Error(err, "Failed to prune "+ref.Kind, ref.Kind+".Name", ref.Name)
+		return &componentError{component, reasonPruneFailed, err}
+	}
+	log.Info("Pruned "+ref.Kind, ref.Kind+".Name", ref.Name)
+	r.Recorder.Eventf(instance, corev1.EventTypeNormal, reasonPruned,
+		"Deleted %s %s, which the source of %s no longer renders", ref.Kind, ref.Name, component)
+	return nil
+}
+
+// controlledRendered returns the live object of a rendered object that
+// instance still controls, or nil if there is none.
+func (r *MeshReconciler) controlledRendered(ctx context.Context, instance *v1beta1.Mesh, ref v1beta1.RenderedObject) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(ref.APIVersion)
+	obj.SetKind(ref.Kind)
+	err := r.Client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: instance.Namespace}, obj)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil || !metav1.IsControlledBy(obj, instance) {
+		return nil, err
+	}
+	return obj, nil
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+func TestReconcileSource(t *testing.T) {
+	ctx := context.Background()
+	mesh := newTestMesh()
+	mesh.Spec.Components.Backend.Source = &v1beta1.ComponentSource{Kustomize: "kustomize"}
+	r := newTestReconciler(t, mesh)
+	r.SourceDir = "../render/testdata/sources"
+	request := reconcile.Request{NamespacedName: types.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}}
+
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	deployment := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: render.Backend, Namespace: mesh.Namespace}, deployment); err != nil {
+		t.Fatal(err)
+	}
+	if deployment.Spec.Template.Spec.Containers[0].Image != "backend:kustomize" || deployment.Labels["tier"] != "backend" {
+		t.Errorf("Deployment was not rendered by Kustomize: %+v", deployment.ObjectMeta)
+	}
+	if !metav1.IsControlledBy(deployment, mesh) {
+		t.Errorf("rendered Deployment is not controlled by the Mesh")
+	}
+	service := &corev1.Service{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: render.Backend, Namespace: mesh.Namespace}, service); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Client.Get(ctx, request.NamespacedName, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(mesh.Status.Components[1].Rendered); got != 2 {
+		t.Errorf("rendered objects in status: got %d, want 2", got)
+	}
+
+	mesh.Spec.Components.Backend.Source.Kustomize = "kustomize-deployment-only"
+	if err := r.Client.Update(ctx, mesh); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reconcile(ctx, request); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: render.Backend, Namespace: mesh.Namespace}, service)
+	if !errors.IsNotFound(err) {
+		t.Errorf("Service no longer rendered was not pruned: %v", err)
+	}
+
+	mesh.Spec.Components.Backend.Source.Kustomize = "../kustomize"
+	if _, err := render.Source(ctx, mesh, render.Backend, mesh.Spec.Components.Backend.Source, render.Options{SourceDir: r.SourceDir}); err == nil {
+		t.Errorf("source outside the source directory was rendered")
+	}
+}
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+// templateIndex indexes Meshes by the name of the MeshTemplate they reference.
+const templateIndex = "spec.template"
+
+func indexTemplate(obj client.Object) []string {
+	mesh := obj.(*v1beta1.Mesh)
+	if mesh.Spec.Template == "" {
+		return nil
+	}
+	return []string{mesh.Spec.Template}
+}
+
+// applyTemplate replaces the components of instance with their effective
+// settings: the defaults of the Mesh's MeshTemplate, overridden by the Mesh's
+// own settings. Only the status of instance is ever written back, so the
+// stored spec keeps the overrides alone.
+func (r *MeshReconciler) applyTemplate(ctx context.Context, instance *v1beta1.Mesh) error {
+	if instance.Spec.Template == "" {
+		return nil
+	}
+	template := &v1beta1.MeshTemplate{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: instance.Spec.Template}, template); err != nil {
+		return err
+	}
+	render.ApplyTemplate(instance, template)
+	return nil
+}
+
+// meshesForTemplate maps a MeshTemplate to the Meshes that reference it, so
+// that they are reconciled again when it changes.
+func (r *MeshReconciler) meshesForTemplate(ctx context.Context, template client.Object) []reconcile.Request {
+	meshes := &v1beta1.MeshList{}
+	if err := r.Client.List(ctx, meshes, client.MatchingFields{templateIndex: template.GetName()}); err != nil {
+		r.Log.Error(err, "Failed to list the Meshes of a MeshTemplate", "MeshTemplate", template.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(meshes.Items))
+	for _, mesh := range meshes.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&mesh)})
+	}
+	return requests
+}
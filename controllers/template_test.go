@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+func TestReconcileTemplate(t *testing.T) {
+	ctx := context.Background()
+	template := &v1beta1.MeshTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "golden-path"},
+		Spec: v1beta1.MeshTemplateSpec{
+			Components: v1beta1.MeshTemplateComponents{
+				Frontend: v1beta1.ComponentTemplate{
+					Image: "frontend:template",
+					Env: []corev1.EnvVar{
+						{Name: "LOG_LEVEL", Value: "info"},
+						{Name: "REGION", Value: "eu"},
+					},
+					ReadinessProbe: &corev1.Probe{
+						ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/healthz"}},
+					},
+				},
+			},
+		},
+	}
+	mesh := newTestMesh()
+	mesh.Spec.Template = template.Name
+	mesh.Spec.Components.Frontend = v1beta1.ComponentSpec{ComponentTemplate: v1beta1.ComponentTemplate{
+		Env: []corev1.EnvVar{{Name: "LOG_LEVEL", Value: "debug"}},
+	}}
+	other := newTestMesh()
+	other.Name = "other"
+	r := newTestReconciler(t, mesh, other, template)
+
+	requests := r.meshesForTemplate(ctx, template)
+	if len(requests) != 1 || requests[0].Name != mesh.Name {
+		t.Errorf("meshesForTemplate: got %v, want only %s", requests, mesh.Name)
+	}
+
+	if _, err := r.Reconcile(ctx, reconcile.Request{NamespacedName: types.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}}); err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+	deployment := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: render.Frontend, Namespace: mesh.Namespace}, deployment); err != nil {
+		t.Fatal(err)
+	}
+	container := deployment.Spec.Template.Spec.Containers[0]
+	if container.Image != "frontend:template" {
+		t.Errorf("image: got %q, want the template's", container.Image)
+	}
+	want := []corev1.EnvVar{{Name: "LOG_LEVEL", Value: "debug"}, {Name: "REGION", Value: "eu"}}
+	if len(container.Env) != 2 || container.Env[0] != want[0] || container.Env[1] != want[1] {
+		t.Errorf("env: got %v, want %v", container.Env, want)
+	}
+	if container.ReadinessProbe == nil || container.ReadinessProbe.HTTPGet.Path != "/healthz" {
+		t.Errorf("readiness probe: got %v, want the template's", container.ReadinessProbe)
+	}
+
+	stored := &v1beta1.Mesh{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: mesh.Name, Namespace: mesh.Namespace}, stored); err != nil {
+		t.Fatal(err)
+	}
+	if stored.Spec.Components.Frontend.Image != "" {
+		t.Errorf("template defaults were written to the Mesh spec: %+v", stored.Spec.Components.Frontend)
+	}
+}
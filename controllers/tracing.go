@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// TracerName is the instrumentation name of the spans recorded by the controller.
+const TracerName = "github.com/vilayilarun/pkg/controllers"
+
+// NewTracingClient wraps c so that every Get, Create, Update, Patch and Delete
+// is recorded as a span of tracer, as a child of the span in the call's context.
+func NewTracingClient(c client.Client, tracer trace.Tracer) client.Client {
+	return &tracingClient{Client: c, tracer: tracer}
+}
+
+type tracingClient struct {
+	client.Client
+	tracer trace.Tracer
+}
+
+func (c *tracingClient) start(ctx context.Context, verb string, obj runtime.Object, namespace, name string) (context.Context, trace.Span) {
+	kind := "Unknown"
+	if gvk, err := apiutil.GVKForObject(obj, c.Scheme()); err == nil {
+		kind = gvk.Kind
+	}
+	return c.tracer.Start(ctx, verb+" "+kind, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("k8s.object.kind", kind),
+		attribute.String("k8s.object.namespace", namespace),
+		attribute.String("k8s.object.name", name),
+	))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (c *tracingClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) (err error) {
+	ctx, span := c.start(ctx, "Get", obj, key.Namespace, key.Name)
+	defer func() { endSpan(span, err) }()
+	return c.Client.Get(ctx, key, obj, opts...)
+}
+
+func (c *tracingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) (err error) {
+	ctx, span := c.start(ctx, "Create", obj, obj.GetNamespace(), obj.GetName())
+	defer func() { endSpan(span, err) }()
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) (err error) {
+	ctx, span := c.start(ctx, "Update", obj, obj.GetNamespace(), obj.GetName())
+	defer func() { endSpan(span, err) }()
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) (err error) {
+	ctx, span := c.start(ctx, "Patch", obj, obj.GetNamespace(), obj.GetName())
+	defer func() { endSpan(span, err) }()
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func (c *tracingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) (err error) {
+	ctx, span := c.start(ctx, "Delete", obj, obj.GetNamespace(), obj.GetName())
+	defer func() { endSpan(span, err) }()
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *tracingClient) Status() client.SubResourceWriter {
+	return &tracingStatusWriter{SubResourceWriter: c.Client.Status(), client: c}
+}
+
+type tracingStatusWriter struct {
+	client.SubResourceWriter
+	client *tracingClient
+}
+
+func (w *tracingStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.SubResourceUpdateOption) (err error) {
+	ctx, span := w.client.start(ctx, "UpdateStatus", obj, obj.GetNamespace(), obj.GetName())
+	defer func() { endSpan(span, err) }()
+	return w.SubResourceWriter.Update(ctx, obj, opts...)
+}
+
+func (w *tracingStatusWriter) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.SubResourcePatchOption) (err error) {
+	ctx, span := w.client.start(ctx, "PatchStatus", obj, obj.GetNamespace(), obj.GetName())
+	defer func() { endSpan(span, err) }()
+	return w.SubResourceWriter.Patch(ctx, obj, patch, opts...)
+}
+
+// startReconcileSpan starts the root span of a reconcile. It returns a no-op
+// span when the reconciler has no Tracer.
+func (r *MeshReconciler) startReconcileSpan(ctx context.Context, namespace, name string) (context.Context, trace.Span) {
+	if r.Tracer == nil {
+		return ctx, trace.SpanFromContext(context.Background())
+	}
+	return r.Tracer.Start(ctx, "Reconcile Mesh", trace.WithAttributes(
+		attribute.String("mesh.namespace", namespace),
+		attribute.String("mesh.name", name),
+	))
+}
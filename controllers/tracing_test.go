@@ -0,0 +1,58 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestReconcileTracing(t *testing.T) {
+	mesh := newTestMesh()
+	mesh.Generation = 4
+	r := newTestReconciler(t, mesh)
+
+	spans := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)).Tracer(TracerName)
+	r.Client = NewTracingClient(r.Client, tracer)
+	r.Tracer = tracer
+
+	_, err := r.Reconcile(context.Background(), reconcile.Request{NamespacedName: types.NamespacedName{Name: "mesh-sample", Namespace: "default"}})
+	if err != nil {
+		t.Fatalf("Reconcile: %v", err)
+	}
+
+	ended := spans.Ended()
+	var root sdktrace.ReadOnlySpan
+	for _, span := range ended {
+		if span.Name() == "Reconcile Mesh" {
+			root = span
+		}
+	}
+	if root == nil {
+		t.Fatalf("no reconcile span recorded")
+	}
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range root.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["mesh.name"].AsString() != "mesh-sample" || attrs["mesh.namespace"].AsString() != "default" || attrs["mesh.generation"].AsInt64() != 4 {
+		t.Errorf("unexpected reconcile span attributes: %v", root.Attributes())
+	}
+
+	children := map[string]bool{}
+	for _, span := range ended {
+		if span.Parent().SpanID() == root.SpanContext().SpanID() {
+			children[span.Name()] = true
+		}
+	}
+	for _, name := range []string{"Get Mesh", "Get Deployment", "Patch Deployment", "UpdateStatus Mesh"} {
+		if !children[name] {
+			t.Errorf("missing child span %q, got %v", name, children)
+		}
+	}
+}
@@ -95,24 +95,39 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"flag"
+	"fmt"
 	logr "github.com/go-logr/logr"
 	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes/scheme"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	meshcomv1alpha1 "github.com/vilayilarun/pkg/api/v1alpha1"
+	meshcomv1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
 	"github.com/vilayilarun/pkg/controllers"
-	"sigs.k8s.io/controller-runtime/pkg/manager"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -130,18 +145,97 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme.Scheme))
 
 	utilruntime.Must(meshcomv1alpha1.AddToScheme(scheme.Scheme))
+	utilruntime.Must(meshcomv1beta1.AddToScheme(scheme.Scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		var run func([]string) error
+		switch os.Args[1] {
+		case "plan":
+			run = runPlan
+		case "render":
+			run = runRender
+		}
+		if run != nil {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var otlpEndpoint string
+	var otlpInsecure bool
+	var traceSampleRatio float64
+	var forceOwnership bool
+	var watchNamespaces string
+	var shard controllers.Shard
+	var maxConcurrentReconciles int
+	var retryBaseDelay, retryMaxDelay, requeueInterval time.Duration
+	var retryQPS float64
+	var retryBurst int
+	var sourceDir string
+	var imageUpdateInterval time.Duration
+	var imageWebhookAddr, imageWebhookTokenFile string
+	var vaultAddr, vaultPathPrefix string
+	var secretRefreshInterval time.Duration
+	var policyConfigMap string
+	var signatureKeysFile string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.StringVar(&otlpEndpoint, "otlp-endpoint", "",
+		"The host:port of an OTLP gRPC collector to export reconcile traces to. Tracing is disabled when empty.")
+	flag.BoolVar(&otlpInsecure, "otlp-insecure", false, "Connect to the OTLP collector without TLS.")
+	flag.Float64Var(&traceSampleRatio, "trace-sample-ratio", 1, "The fraction of reconciles to trace, between 0 and 1.")
+	flag.BoolVar(&forceOwnership, "force-ownership", false,
+		"Take over fields of Mesh children that another field manager owns. "+
+			"By default such conflicts are reported in the Mesh status and the child is left alone.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma-separated namespaces to watch Meshes and their children in. "+
+			"All namespaces are watched, which needs cluster-wide RBAC, when empty.")
+	flag.IntVar(&shard.Count, "shard-count", 1,
+		"The number of shards Meshes are partitioned into. Run one replica per shard, each with its own --shard-id.")
+	flag.IntVar(&shard.ID, "shard-id", 0, "The shard of Meshes this replica reconciles, from 0 to --shard-count minus 1.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1, "The number of Meshes reconciled in parallel.")
+	flag.DurationVar(&retryBaseDelay, "retry-base-delay", 5*time.Millisecond,
+		"The delay before the first retry of a failed reconcile. It doubles with every further failure of the same Mesh.")
+	flag.DurationVar(&retryMaxDelay, "retry-max-delay", 1000*time.Second, "The longest delay between retries of a failed reconcile.")
+	flag.Float64Var(&retryQPS, "retry-qps", 10, "The overall number of retries allowed per second, across all Meshes.")
+	flag.IntVar(&retryBurst, "retry-burst", 100, "The number of retries allowed in a burst above --retry-qps.")
+	flag.DurationVar(&requeueInterval, "requeue-interval", 0,
+		"How often every Mesh is reconciled again to refresh its status. Disabled when 0.")
+	flag.StringVar(&sourceDir, "source-dir", "/etc/mesh-sources",
+		"The directory that Kustomize and chart paths of component sources are resolved in.")
+	flag.DurationVar(&imageUpdateInterval, "image-update-interval", 5*time.Minute,
+		"How often registries are polled for new tags of components with an image update policy. Disabled when 0.")
+	flag.StringVar(&imageWebhookAddr, "image-webhook-bind-address", "",
+		"The address registry push notifications are received on, e.g. :8082. Disabled when empty.")
+	flag.StringVar(&imageWebhookTokenFile, "image-webhook-token-file", "",
+		"A file holding the token registry push notifications must carry as \"Authorization: Bearer <token>\". "+
+			"Required with --image-webhook-bind-address.")
+	flag.StringVar(&vaultAddr, "vault-address", os.Getenv("VAULT_ADDR"),
+		"The URL of the Vault server external secrets are read from with the vault provider, authenticated with "+
+			"the token in the VAULT_TOKEN environment variable. The vault provider is disabled when empty.")
+	flag.StringVar(&vaultPathPrefix, "vault-path-prefix", "",
+		"The path in Vault mounts below which the secrets of each namespace are kept. A Mesh reading <mount>/<path> "+
+			"gets <mount>/<prefix>/<namespace>/<path>.")
+	flag.DurationVar(&secretRefreshInterval, "secret-refresh-interval", 5*time.Minute,
+		"How often external secrets of components are read again. Disabled when 0.")
+	flag.StringVar(&policyConfigMap, "policy-configmap", "",
+		"The namespace/name of a ConfigMap of CEL rules the children of Meshes must satisfy to be applied. "+
+			"It must be in one of the --watch-namespaces, if set. Disabled when empty.")
+	flag.StringVar(&signatureKeysFile, "signature-keys", "",
+		"A file of PEM encoded cosign public keys, such as one mounted from a Secret in the operator's namespace. "+
+			"When set, the image of every component of every Mesh must be signed with one of them. Disabled when empty.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -149,32 +243,123 @@ func main() {
 	flag.Parse()
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
-	// mgrOptions := manager.Options{
-	// 	MetricsBindAddress: "0.0.0.0:8080",
-	// 	// Add other options here if needed
-	// }
+	ctx := ctrl.SetupSignalHandler()
+
+	if shard.ID < 0 || (shard.Enabled() && shard.ID >= shard.Count) {
+		setupLog.Error(fmt.Errorf("shard %d out of range for %d shards", shard.ID, shard.Count), "invalid shard")
+		os.Exit(1)
+	}
+	// Replicas of the same shard elect a leader among themselves, so that
+	// each Mesh has exactly one active reconciler.
+	leaderElectionID := "cdbd3f8f.mesh.com"
+	if shard.Enabled() {
+		leaderElectionID = fmt.Sprintf("shard-%d.%s", shard.ID, leaderElectionID)
+	}
 
+	cacheOpts := cacheOptions(watchNamespaces)
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme: scheme.Scheme,
-		// MetricsBindAddress:     metricsAddr,
-		// Port:                   9443,
+		Scheme:                 scheme.Scheme,
+		Cache:                  cacheOpts,
+		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
+		WebhookServer:          webhook.NewServer(webhook.Options{Port: 9443}),
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "cdbd3f8f.mesh.com",
+		LeaderElectionID:       leaderElectionID,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
-	if err = (&controllers.MeshReconciler{
-		Client: mgr.GetClient(),
-		Log:    ctrl.Log.WithName("controllers").WithName("MyOperator"),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	reconciler := &controllers.MeshReconciler{
+		Client:    mgr.GetClient(),
+		APIReader: mgr.GetAPIReader(),
+		Log:       ctrl.Log.WithName("controllers").WithName("MyOperator"),
+		Scheme:    mgr.GetScheme(),
+		Recorder:  mgr.GetEventRecorderFor("mesh-controller"),
+
+		ForceOwnership: forceOwnership,
+		Shard:          shard,
+
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		RateLimiter:             controllers.NewRateLimiter(retryBaseDelay, retryMaxDelay, retryQPS, retryBurst),
+		RequeueInterval:         requeueInterval,
+
+		SourceDir: sourceDir,
+
+		ImageUpdateInterval: imageUpdateInterval,
+
+		SecretRefreshInterval: secretRefreshInterval,
+	}
+	if policyConfigMap != "" {
+		namespace, name, ok := strings.Cut(policyConfigMap, "/")
+		if !ok || namespace == "" || name == "" {
+			setupLog.Error(fmt.Errorf("%q is not of the form namespace/name", policyConfigMap), "invalid --policy-configmap")
+			os.Exit(1)
+		}
+		// The rules are read from the cache, which only holds the watched
+		// namespaces.
+		if _, ok := cacheOpts.DefaultNamespaces[namespace]; cacheOpts.DefaultNamespaces != nil && !ok {
+			setupLog.Error(fmt.Errorf("namespace %s of %s is not watched", namespace, policyConfigMap), "invalid --policy-configmap")
+			os.Exit(1)
+		}
+		reconciler.Policy = controllers.NewPolicyEngine(mgr.GetClient(), types.NamespacedName{Namespace: namespace, Name: name})
+	}
+	if signatureKeysFile != "" {
+		data, err := os.ReadFile(signatureKeysFile)
+		if err == nil {
+			reconciler.SignatureKeys, err = controllers.ParseSignatureKeys(data)
+		}
+		if err != nil {
+			setupLog.Error(err, "invalid --signature-keys")
+			os.Exit(1)
+		}
+	}
+	if vaultAddr != "" {
+		reconciler.SecretProviders = map[string]controllers.SecretProvider{
+			"vault": &controllers.VaultSecretProvider{Address: vaultAddr, Token: os.Getenv("VAULT_TOKEN"), PathPrefix: vaultPathPrefix},
+		}
+	}
+	if imageWebhookAddr != "" {
+		token, err := os.ReadFile(imageWebhookTokenFile)
+		if err == nil && len(bytes.TrimSpace(token)) == 0 {
+			err = fmt.Errorf("no token in %q", imageWebhookTokenFile)
+		}
+		if err != nil {
+			setupLog.Error(err, "invalid --image-webhook-token-file")
+			os.Exit(1)
+		}
+		imageWebhook := controllers.NewImageWebhook(mgr.GetClient(), ctrl.Log.WithName("image-webhook"), imageWebhookAddr, string(bytes.TrimSpace(token)))
+		if err := mgr.Add(imageWebhook); err != nil {
+			setupLog.Error(err, "unable to add image webhook")
+			os.Exit(1)
+		}
+		reconciler.ImageEvents = imageWebhook.Events()
+	}
+	if otlpEndpoint != "" {
+		tracerProvider, err := setupTracing(ctx, otlpEndpoint, otlpInsecure, traceSampleRatio)
+		if err != nil {
+			setupLog.Error(err, "unable to set up tracing")
+			os.Exit(1)
+		}
+		defer func() {
+			if err := tracerProvider.Shutdown(context.Background()); err != nil {
+				setupLog.Error(err, "problem flushing traces")
+			}
+		}()
+		reconciler.Tracer = tracerProvider.Tracer(controllers.TracerName)
+		reconciler.Client = controllers.NewTracingClient(reconciler.Client, reconciler.Tracer)
+	}
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Mesh")
 		os.Exit(1)
 	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&meshcomv1beta1.Mesh{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Mesh")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -187,8 +372,45 @@ func main() {
 	}
 
 	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// cacheOptions restricts the manager's cache to the comma-separated
+// namespaces, so that it only lists and watches objects in them.
+func cacheOptions(namespaces string) cache.Options {
+	options := cache.Options{}
+	for _, namespace := range strings.Split(namespaces, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace == "" {
+			continue
+		}
+		if options.DefaultNamespaces == nil {
+			options.DefaultNamespaces = map[string]cache.Config{}
+		}
+		options.DefaultNamespaces[namespace] = cache.Config{}
+	}
+	return options
+}
+
+// setupTracing creates a tracer provider that exports spans to the OTLP gRPC
+// collector at endpoint, and installs it as the global provider.
+func setupTracing(ctx context.Context, endpoint string, insecure bool, sampleRatio float64) (*sdktrace.TracerProvider, error) {
+	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if insecure {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName("mesh-operator"))),
+	)
+	otel.SetTracerProvider(tracerProvider)
+	return tracerProvider, nil
+}
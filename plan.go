@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	logr "github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	meshcomv1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/controllers"
+)
+
+// runPlan implements the plan subcommand, which prints the changes the
+// operator would make to the children of a Mesh without making them.
+func runPlan(args []string) error {
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	file := flags.String("f", "", "The file holding the Mesh to plan.")
+	manifests := flags.String("manifests", "",
+		"A directory of manifests to compare the children of the Mesh with instead of the cluster. "+
+			"All objects in it are taken to be children of the Mesh.")
+	output := flags.String("o", "text", "The output format: text or json.")
+	sourceDir := flags.String("source-dir", "/etc/mesh-sources",
+		"The directory that Kustomize and chart paths of component sources are resolved in.")
+	policyConfigMap := flags.String("policy-configmap", "",
+		"The namespace/name of a ConfigMap of CEL rules the children must satisfy. Disabled when empty.")
+	vaultPathPrefix := flags.String("vault-path-prefix", "",
+		"The path in Vault mounts below which the secrets of each namespace are kept, as for the manager.")
+	signatureKeys := flags.String("signature-keys", "",
+		"A file of PEM encoded cosign public keys component images must be signed with, as for the manager.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s plan -f mesh.yaml [--manifests dir] [-o text|json]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		flags.Usage()
+		return errors.New("-f is required")
+	}
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	ctx := context.Background()
+	mesh, err := readMesh(*file)
+	if err != nil {
+		return err
+	}
+	var c client.Client
+	var existing []client.Object
+	if *manifests != "" {
+		if existing, err = readManifests(*manifests, mesh.Namespace); err != nil {
+			return err
+		}
+		c = fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(existing...).Build()
+	} else {
+		cfg, err := ctrl.GetConfig()
+		if err != nil {
+			return err
+		}
+		if c, err = client.New(cfg, client.Options{Scheme: scheme.Scheme}); err != nil {
+			return err
+		}
+		// Stale children are found through the status and UID of the live
+		// Mesh.
+		live := &meshcomv1beta1.Mesh{}
+		err = c.Get(ctx, client.ObjectKeyFromObject(mesh), live)
+		switch {
+		case err == nil:
+			mesh.UID, mesh.Status = live.UID, live.Status
+		case !apierrors.IsNotFound(err):
+			return err
+		}
+	}
+
+	reconciler := &controllers.MeshReconciler{
+		Client:    client.NewDryRunClient(c),
+		Log:       logr.Discard(),
+		Scheme:    scheme.Scheme,
+		Recorder:  &record.FakeRecorder{},
+		SourceDir: *sourceDir,
+	}
+	if *policyConfigMap != "" {
+		namespace, name, ok := strings.Cut(*policyConfigMap, "/")
+		if !ok || namespace == "" || name == "" {
+			return fmt.Errorf("%q is not of the form namespace/name", *policyConfigMap)
+		}
+		reconciler.Policy = controllers.NewPolicyEngine(c, types.NamespacedName{Namespace: namespace, Name: name})
+	}
+	if *signatureKeys != "" {
+		data, err := os.ReadFile(*signatureKeys)
+		if err != nil {
+			return err
+		}
+		if reconciler.SignatureKeys, err = controllers.ParseSignatureKeys(data); err != nil {
+			return fmt.Errorf("%s: %w", *signatureKeys, err)
+		}
+	}
+	if addr := os.Getenv("VAULT_ADDR"); addr != "" {
+		reconciler.SecretProviders = map[string]controllers.SecretProvider{
+			"vault": &controllers.VaultSecretProvider{Address: addr, Token: os.Getenv("VAULT_TOKEN"), PathPrefix: *vaultPathPrefix},
+		}
+	}
+	changes, planErr := reconciler.Plan(ctx, mesh, existing)
+	if err := printPlan(os.Stdout, mesh, changes, *output); err != nil {
+		return err
+	}
+	return planErr
+}
+
+// readMesh reads a Mesh of either version from a YAML or JSON file. A Mesh
+// without a namespace is in the default namespace.
+func readMesh(path string) (*meshcomv1beta1.Mesh, error) {
+	objects, err := readObjects(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) != 1 {
+		return nil, fmt.Errorf("%s holds %d objects, not one Mesh", path, len(objects))
+	}
+	mesh, ok := objects[0].(*meshcomv1beta1.Mesh)
+	if !ok {
+		return nil, fmt.Errorf("%s holds a %T, not a Mesh", path, objects[0])
+	}
+	if mesh.Namespace == "" {
+		mesh.Namespace = "default"
+	}
+	return mesh, nil
+}
+
+// readManifests reads the objects in the YAML and JSON files of a directory,
+// putting those without a namespace in namespace.
+func readManifests(dir, namespace string) ([]client.Object, error) {
+	var objects []client.Object
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml", ".json":
+		default:
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		decoder := utilyaml.NewYAMLOrJSONDecoder(f, 4096)
+		for {
+			obj := &unstructured.Unstructured{}
+			if err := decoder.Decode(&obj.Object); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			}
+			if len(obj.Object) == 0 {
+				continue
+			}
+			if obj.GetNamespace() == "" {
+				obj.SetNamespace(namespace)
+			}
+			objects = append(objects, obj)
+		}
+	})
+	return objects, err
+}
+
+// printPlan prints the changes planned for mesh as text or JSON.
+func printPlan(w io.Writer, mesh *meshcomv1beta1.Mesh, changes []controllers.PlannedChange, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(struct {
+			Mesh    string                      `json:"mesh"`
+			Changes []controllers.PlannedChange `json:"changes"`
+		}{client.ObjectKeyFromObject(mesh).String(), append([]controllers.PlannedChange{}, changes...)})
+	}
+
+	counts := map[controllers.PlanAction]int{}
+	for _, change := range changes {
+		counts[change.Action]++
+	}
+	fmt.Fprintf(w, "Mesh %s: %d to create, %d to update, %d to delete\n", client.ObjectKeyFromObject(mesh),
+		counts[controllers.PlanCreate], counts[controllers.PlanUpdate], counts[controllers.PlanDelete])
+	symbols := map[controllers.PlanAction]string{controllers.PlanCreate: "+", controllers.PlanUpdate: "~", controllers.PlanDelete: "-"}
+	for _, change := range changes {
+		line := fmt.Sprintf("%s %s %s", symbols[change.Action], change.Kind, change.Name)
+		if change.Component != "" {
+			line += " (" + change.Component + ")"
+		}
+		fmt.Fprintln(w, line)
+		fields := append([]controllers.FieldChange{}, change.Fields...)
+		sort.SliceStable(fields, func(i, j int) bool { return fields[i].Path < fields[j].Path })
+		for _, field := range fields {
+			fmt.Fprintf(w, "    %s: %s -> %s\n", field.Path, formatValue(field.Live), formatValue(field.Desired))
+		}
+	}
+	return nil
+}
+
+func formatValue(v interface{}) string {
+	if v == nil {
+		return "<none>"
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return strings.TrimSpace(string(data))
+}
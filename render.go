@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	meshcomv1alpha1 "github.com/vilayilarun/pkg/api/v1alpha1"
+	meshcomv1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+	"github.com/vilayilarun/pkg/render"
+)
+
+// fileList is a flag that may be given several times.
+type fileList []string
+
+func (f *fileList) String() string { return strings.Join(*f, ",") }
+
+func (f *fileList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// runRender implements the render subcommand, which prints the child objects
+// of Meshes as multi-document YAML without contacting a cluster.
+func runRender(args []string) error {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	var files fileList
+	flags.Var(&files, "f", "A file of Meshes and the MeshTemplates they use, or - for standard input. May be repeated.")
+	namespace := flags.String("namespace", "default", "The namespace of Meshes that do not set one.")
+	sourceDir := flags.String("source-dir", "/etc/mesh-sources",
+		"The directory that Kustomize and chart paths of component sources are resolved in.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s render -f mesh.yaml [-f template.yaml] [--namespace ns]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		flags.Usage()
+		return errors.New("-f is required")
+	}
+
+	var meshes []*meshcomv1beta1.Mesh
+	templates := map[string]*meshcomv1beta1.MeshTemplate{}
+	for _, file := range files {
+		objects, err := readObjects(file)
+		if err != nil {
+			return err
+		}
+		for _, obj := range objects {
+			switch obj := obj.(type) {
+			case *meshcomv1beta1.Mesh:
+				meshes = append(meshes, obj)
+			case *meshcomv1beta1.MeshTemplate:
+				templates[obj.Name] = obj
+			default:
+				return fmt.Errorf("%s holds a %T, not a Mesh or MeshTemplate", file, obj)
+			}
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	for _, mesh := range meshes {
+		if mesh.Namespace == "" {
+			mesh.Namespace = *namespace
+		}
+		if mesh.Spec.Template != "" {
+			template, ok := templates[mesh.Spec.Template]
+			if !ok {
+				return fmt.Errorf("Mesh %s: MeshTemplate %s is not in the given files", mesh.Name, mesh.Spec.Template)
+			}
+			render.ApplyTemplate(mesh, template)
+		}
+		objects, err := render.Mesh(context.Background(), mesh, render.Options{SourceDir: *sourceDir, ChartKeychain: authn.DefaultKeychain})
+		if err != nil {
+			return fmt.Errorf("Mesh %s: %w", mesh.Name, err)
+		}
+		for _, obj := range objects {
+			data, err := manifest(obj)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "---\n%s", data)
+		}
+	}
+	return out.Flush()
+}
+
+// readObjects decodes the documents of a YAML or JSON file, or of standard
+// input if path is -. Meshes of v1alpha1 are converted to v1beta1.
+func readObjects(path string) ([]runtime.Object, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := serializer.NewCodecFactory(scheme.Scheme).UniversalDeserializer()
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	var objects []runtime.Object
+	for {
+		doc, err := reader.Read()
+		if err == io.EOF {
+			return objects, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		obj, _, err := decoder.Decode(doc, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if old, ok := obj.(*meshcomv1alpha1.Mesh); ok {
+			mesh := &meshcomv1beta1.Mesh{}
+			if err := old.ConvertTo(mesh); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			obj = mesh
+		}
+		objects = append(objects, obj)
+	}
+}
+
+// manifest returns obj as YAML without the empty status and creation
+// timestamp of typed objects.
+func manifest(obj client.Object) ([]byte, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	delete(content, "status")
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok && metadata["creationTimestamp"] == nil {
+		delete(metadata, "creationTimestamp")
+	}
+	return yaml.Marshal(content)
+}
@@ -0,0 +1,116 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/registry"
+)
+
+const (
+	// chartPullTimeout bounds pulling a chart from an OCI registry, so that
+	// a slow registry cannot hold up a reconcile.
+	chartPullTimeout = time.Minute
+
+	// maxCachedCharts bounds the number of charts a ChartCache holds.
+	maxCachedCharts = 64
+)
+
+// ChartCache holds charts pulled from OCI registries by the digest of their
+// manifest, so that a chart is only downloaded again when its tag moves. The
+// zero value is an empty cache.
+type ChartCache struct {
+	mu     sync.Mutex
+	charts map[string]*chart.Chart
+}
+
+// pull returns the chart ref, an oci:// reference, pulled with the
+// credentials of keychain or taken from c if it has the chart of the same
+// digest. A nil c pulls every time.
+func (c *ChartCache) pull(ctx context.Context, ref string, keychain authn.Keychain) (*chart.Chart, error) {
+	reference, err := name.ParseReference(strings.TrimPrefix(ref, "oci://"))
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, chartPullTimeout)
+	defer cancel()
+	options := []remote.Option{remote.WithContext(ctx), remote.WithAuthFromKeychain(keychain)}
+
+	digest, pinned := reference.(name.Digest)
+	if !pinned {
+		descriptor, err := remote.Head(reference, options...)
+		if err != nil {
+			return nil, fmt.Errorf("resolving chart %s: %w", ref, err)
+		}
+		digest = reference.Context().Digest(descriptor.Digest.String())
+	}
+	if chrt := c.get(digest.String()); chrt != nil {
+		return chrt, nil
+	}
+
+	image, err := remote.Image(digest, options...)
+	if err != nil {
+		return nil, fmt.Errorf("pulling chart %s: %w", ref, err)
+	}
+	layers, err := image.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("pulling chart %s: %w", ref, err)
+	}
+	for _, layer := range layers {
+		mediaType, err := layer.MediaType()
+		if err != nil {
+			return nil, fmt.Errorf("pulling chart %s: %w", ref, err)
+		}
+		if mediaType != registry.ChartLayerMediaType && mediaType != registry.LegacyChartLayerMediaType {
+			continue
+		}
+		content, err := layer.Compressed()
+		if err != nil {
+			return nil, fmt.Errorf("pulling chart %s: %w", ref, err)
+		}
+		defer content.Close()
+		chrt, err := loader.LoadArchive(content)
+		if err != nil {
+			return nil, fmt.Errorf("chart %s: %w", ref, err)
+		}
+		c.add(digest.String(), chrt)
+		return chrt, nil
+	}
+	return nil, fmt.Errorf("%s is not a chart: it has no layer of type %s", ref, registry.ChartLayerMediaType)
+}
+
+func (c *ChartCache) get(key string) *chart.Chart {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.charts[key]
+}
+
+func (c *ChartCache) add(key string, chrt *chart.Chart) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.charts == nil {
+		c.charts = map[string]*chart.Chart{}
+	}
+	if len(c.charts) >= maxCachedCharts {
+		// Drop any chart; one that is still in use is pulled again.
+		for key := range c.charts {
+			delete(c.charts, key)
+			break
+		}
+	}
+	c.charts[key] = chrt
+}
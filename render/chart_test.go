@@ -0,0 +1,108 @@
+package render
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"github.com/google/go-containerregistry/pkg/name"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/static"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/registry"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+// newChartRegistry starts an in-process registry that requires basic auth as
+// user:secret and pushes testdata/sources/chart to it as backend:1.0. It
+// returns the reference of the chart and a count of the blobs downloaded.
+func newChartRegistry(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+	handler := ggcrregistry.New()
+	var blobs atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if user, password, ok := req.BasicAuth(); !ok || user != "user" || password != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.Method == http.MethodGet && strings.Contains(req.URL.Path, "/blobs/") {
+			blobs.Add(1)
+		}
+		handler.ServeHTTP(w, req)
+	}))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	chrt, err := loader.Load("testdata/sources/chart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := chartutil.Save(chrt, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, err := mutate.AppendLayers(empty.Image, static.NewLayer(content, types.MediaType(registry.ChartLayerMediaType)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	image = mutate.ConfigMediaType(image, types.MediaType(registry.ConfigMediaType))
+	ref, err := name.ParseReference(host + "/charts/backend:1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Write(ref, image, remote.WithAuth(&authn.Basic{Username: "user", Password: "secret"})); err != nil {
+		t.Fatal(err)
+	}
+	blobs.Store(0)
+	return "oci://" + ref.String(), &blobs
+}
+
+type staticKeychain struct{ authn.Authenticator }
+
+func (k staticKeychain) Resolve(authn.Resource) (authn.Authenticator, error) {
+	return k.Authenticator, nil
+}
+
+func TestSourceChartRef(t *testing.T) {
+	ctx := context.Background()
+	ref, blobs := newChartRegistry(t)
+	mesh := &v1beta1.Mesh{ObjectMeta: metav1.ObjectMeta{Name: "mesh-sample", Namespace: "default"}}
+	source := &v1beta1.ComponentSource{Chart: &v1beta1.ChartSource{Ref: ref}}
+
+	if _, err := Source(ctx, mesh, Backend, source, Options{}); err == nil {
+		t.Fatalf("chart pulled without credentials")
+	}
+
+	opts := Options{
+		ChartKeychain: staticKeychain{&authn.Basic{Username: "user", Password: "secret"}},
+		Charts:        &ChartCache{},
+	}
+	for i := 0; i < 2; i++ {
+		objects, err := Source(ctx, mesh, Backend, source, opts)
+		if err != nil || len(objects) != 2 {
+			t.Fatalf("Source: got %d objects, %v, want the Deployment and Service", len(objects), err)
+		}
+	}
+	// The chart layer is downloaded by the first pull; the second one only
+	// resolves the tag.
+	if n := blobs.Load(); n != 1 {
+		t.Errorf("downloaded %d blobs, want the chart pulled once", n)
+	}
+}
@@ -0,0 +1,115 @@
+// Package render builds the child objects of a Mesh from its spec. It reads
+// nothing from a cluster, so that the objects the operator applies can also be
+// rendered offline, for example to store or lint them in CI.
+package render
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+// Names of the components of a Mesh.
+const (
+	Frontend = "frontend"
+	Backend  = "backend"
+	App      = "app"
+)
+
+// ComponentNames lists the components of a Mesh in the order they are applied.
+var ComponentNames = []string{Frontend, Backend, App}
+
+// ComponentSpec returns the spec of the named component of a Mesh.
+func ComponentSpec(instance *v1beta1.Mesh, name string) v1beta1.ComponentSpec {
+	return *ComponentSpecRef(instance, name)
+}
+
+// ComponentSpecRef returns a pointer to the spec of the named component of
+// instance.
+func ComponentSpecRef(instance *v1beta1.Mesh, name string) *v1beta1.ComponentSpec {
+	switch name {
+	case Frontend:
+		return &instance.Spec.Components.Frontend
+	case Backend:
+		return &instance.Spec.Components.Backend
+	default:
+		return &instance.Spec.Components.App
+	}
+}
+
+// Options are what rendering needs besides the Mesh. The zero value renders
+// the images of the spec and Secrets without values.
+type Options struct {
+	// SourceDir is the directory that Kustomize and chart paths of component
+	// sources are resolved in.
+	SourceDir string
+
+	// ChartKeychain authenticates pulls of the charts of component sources
+	// from OCI registries. They are pulled anonymously when it is nil.
+	ChartKeychain authn.Keychain
+
+	// Charts caches the charts pulled from OCI registries. Every render of
+	// a chart pulls it when it is nil.
+	Charts *ChartCache
+
+	// Images replace the images of the spec by component, such as with
+	// those resolved by the image policy.
+	Images map[string]string
+
+	// Secrets are the Secrets of components with their generated and
+	// external values, by component. Components without one get a Secret
+	// without values.
+	Secrets map[string]*corev1.Secret
+}
+
+// Component returns the child objects of a component in the order they are
+// applied, rendered from its source if it has one.
+func Component(ctx context.Context, instance *v1beta1.Mesh, name string, opts Options) ([]client.Object, error) {
+	spec := ComponentSpec(instance, name)
+	if spec.Source != nil {
+		rendered, err := Source(ctx, instance, name, spec.Source, opts)
+		if err != nil {
+			return nil, err
+		}
+		objects := make([]client.Object, 0, len(rendered))
+		for _, obj := range rendered {
+			objects = append(objects, obj)
+		}
+		return objects, nil
+	}
+	image := spec.Image
+	if resolved := opts.Images[name]; resolved != "" {
+		image = resolved
+	}
+	secret := opts.Secrets[name]
+	if secret == nil {
+		secret = Secret(instance.Namespace, name)
+	}
+	return Children(instance, name, image, secret), nil
+}
+
+// Mesh returns the child objects of every component of instance that is not
+// paused, in the order they are applied. MeshTemplates must have been applied
+// with ApplyTemplate. Nothing is rendered for a paused Mesh.
+func Mesh(ctx context.Context, instance *v1beta1.Mesh, opts Options) ([]client.Object, error) {
+	if instance.IsPaused() {
+		return nil, nil
+	}
+	var objects []client.Object
+	for _, name := range ComponentNames {
+		if ComponentSpec(instance, name).Paused {
+			continue
+		}
+		children, err := Component(ctx, instance, name, opts)
+		if err != nil {
+			return nil, fmt.Errorf("component %s: %w", name, err)
+		}
+		objects = append(objects, children...)
+	}
+	return objects, nil
+}
@@ -0,0 +1,75 @@
+package render
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+func TestMesh(t *testing.T) {
+	mesh := &v1beta1.Mesh{
+		ObjectMeta: metav1.ObjectMeta{Name: "mesh-sample", Namespace: "prod"},
+		Spec: v1beta1.MeshSpec{
+			Replicas: 2,
+			Template: "base",
+			Components: v1beta1.MeshComponents{
+				Frontend: v1beta1.ComponentSpec{ComponentTemplate: v1beta1.ComponentTemplate{
+					Env: []corev1.EnvVar{{Name: "MODE", Value: "prod"}},
+				}},
+				Backend: v1beta1.ComponentSpec{Source: &v1beta1.ComponentSource{Kustomize: "kustomize"}},
+				App:     v1beta1.ComponentSpec{ComponentTemplate: v1beta1.ComponentTemplate{Image: "app:1.0"}, Paused: true},
+			},
+		},
+	}
+	ApplyTemplate(mesh, &v1beta1.MeshTemplate{
+		ObjectMeta: metav1.ObjectMeta{Name: "base"},
+		Spec: v1beta1.MeshTemplateSpec{Components: v1beta1.MeshTemplateComponents{
+			Frontend: v1beta1.ComponentTemplate{Image: "frontend:1.0", Env: []corev1.EnvVar{{Name: "MODE", Value: "dev"}}},
+		}},
+	})
+
+	objects, err := Mesh(context.Background(), mesh, Options{SourceDir: "testdata/sources", Images: map[string]string{Frontend: "frontend@sha256:abc"}})
+	if err != nil {
+		t.Fatalf("Mesh: %v", err)
+	}
+	var order []string
+	for _, obj := range objects {
+		kind := obj.GetObjectKind().GroupVersionKind().Kind
+		if kind == "" {
+			t.Errorf("%s has no kind", obj.GetName())
+		}
+		if obj.GetNamespace() != "prod" {
+			t.Errorf("%s %s is in namespace %q, want prod", kind, obj.GetName(), obj.GetNamespace())
+		}
+		order = append(order, kind+"/"+obj.GetName())
+	}
+	// The paused app is left out and the backend is rendered from its
+	// source.
+	want := "ConfigMap/frontend-config Secret/frontend-secrets Deployment/frontend Deployment/backend Service/backend"
+	if strings.Join(order, " ") != want {
+		t.Fatalf("rendered %v, want %s", order, want)
+	}
+
+	deployment := objects[2].(*appsv1.Deployment)
+	container := deployment.Spec.Template.Spec.Containers[0]
+	if container.Image != "frontend@sha256:abc" {
+		t.Errorf("frontend image: got %s, want the resolved image", container.Image)
+	}
+	if len(container.Env) != 1 || container.Env[0].Value != "prod" {
+		t.Errorf("frontend env: got %v, want the Mesh's MODE over the template's", container.Env)
+	}
+	if deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != 2 {
+		t.Errorf("frontend replicas: got %v, want 2", deployment.Spec.Replicas)
+	}
+
+	mesh.Spec.Paused = true
+	if objects, err := Mesh(context.Background(), mesh, Options{SourceDir: "testdata/sources"}); err != nil || len(objects) != 0 {
+		t.Errorf("paused Mesh: got %d objects and %v, want none", len(objects), err)
+	}
+}
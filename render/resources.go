@@ -0,0 +1,140 @@
+package render
+
+import (
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+// Children returns the built-in child objects of a component in the order
+// they are applied: the ConfigMap, Secret and ServiceAccount before the
+// Deployment that uses them. The Deployment runs image, the component's image
+// as resolved by the image policy, and secret is the component's Secret with
+// its generated values.
+func Children(instance *v1beta1.Mesh, name, image string, secret *corev1.Secret) []client.Object {
+	spec := ComponentSpec(instance, name)
+	spec.Image = image
+	deployment := Deployment(instance.Namespace, name, spec, instance.Spec.ReplicasFor(spec))
+	if policy := instance.Spec.ImagePolicy; policy != nil {
+		deployment.Spec.Template.Spec.ImagePullSecrets = policy.ImagePullSecrets
+	}
+	if spec.ServiceAccount != nil {
+		deployment.Spec.Template.Spec.ServiceAccountName = name
+	}
+	children := []client.Object{ConfigMap(instance.Namespace, name), secret}
+	children = append(children, ServiceAccount(instance.Namespace, name, spec.ServiceAccount)...)
+	return append(children, deployment)
+}
+
+// Deployment returns the Deployment of a component with only the fields the
+// operator owns set. Replicas are left out when replicas is nil so that an
+// autoscaler can own them.
+func Deployment(namespace, name string, spec v1beta1.ComponentSpec, replicas *int32) *appsv1.Deployment {
+	labels := map[string]string{"app": name}
+	container := corev1.Container{
+		Name:           name,
+		Image:          spec.Image,
+		Env:            spec.Env,
+		LivenessProbe:  spec.LivenessProbe,
+		ReadinessProbe: spec.ReadinessProbe,
+		VolumeMounts: append([]corev1.VolumeMount{
+			{Name: name + "-config", MountPath: "/etc/" + name},
+			{Name: name + "-secrets", MountPath: "/etc/" + name + "/secrets"},
+		}, spec.VolumeMounts...),
+	}
+	if spec.Resources != nil {
+		container.Resources = *spec.Resources
+	}
+	return &appsv1.Deployment{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "apps/v1", Kind: "Deployment"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					Containers: []corev1.Container{container},
+					Volumes: append([]corev1.Volume{
+						{
+							Name: name + "-config",
+							VolumeSource: corev1.VolumeSource{
+								ConfigMap: &corev1.ConfigMapVolumeSource{
+									LocalObjectReference: corev1.LocalObjectReference{Name: name + "-config"},
+								},
+							},
+						},
+						{
+							Name: name + "-secrets",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{SecretName: name + "-secrets"},
+							},
+						},
+					}, spec.Volumes...),
+				},
+			},
+		},
+	}
+}
+
+// ConfigMap returns the ConfigMap of a component.
+func ConfigMap(namespace, name string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name + "-config",
+			Namespace: namespace,
+			Labels:    map[string]string{"app": name},
+		},
+		Data: map[string]string{
+			"config.yaml": name + " configuration",
+		},
+	}
+}
+
+// Secret returns the Secret of a component, without the generated and
+// external values the operator adds. Values are set as Data rather than
+// StringData, since the API server never returns StringData and the applied
+// object would never match the live one.
+func Secret(namespace, name string) *corev1.Secret {
+	return &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name + "-secrets",
+			Namespace: namespace,
+			Labels:    map[string]string{"app": name},
+		},
+	}
+}
+
+// ServiceAccount returns the ServiceAccount of a component followed, if it has
+// rules, by the Role and RoleBinding granting them. It returns nil if the
+// component has no ServiceAccount.
+func ServiceAccount(namespace, name string, spec *v1beta1.ComponentServiceAccount) []client.Object {
+	if spec == nil {
+		return nil
+	}
+	objects := []client.Object{&corev1.ServiceAccount{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: "ServiceAccount"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+	}}
+	if len(spec.Rules) == 0 {
+		return objects
+	}
+	return append(objects,
+		&rbacv1.Role{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "Role"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Rules:      spec.Rules,
+		},
+		&rbacv1.RoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: name},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: name, Namespace: namespace}},
+		})
+}
@@ -0,0 +1,195 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"sigs.k8s.io/yaml"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+// SourceKinds are the kinds of objects a component source may render. They
+// are all namespaced, so that a Mesh cannot reach beyond its namespace, and
+// the operator holds the permissions to manage them.
+var SourceKinds = []schema.GroupKind{
+	{Kind: "ConfigMap"},
+	{Kind: "Secret"},
+	{Kind: "Service"},
+	{Kind: "ServiceAccount"},
+	{Group: "apps", Kind: "Deployment"},
+}
+
+// Source renders the objects of a component from its source, in the
+// namespace of instance. Paths of the source are resolved in the SourceDir
+// of opts and charts are pulled with its ChartKeychain. Objects of other
+// kinds than SourceKinds are rejected.
+func Source(ctx context.Context, instance *v1beta1.Mesh, component string, source *v1beta1.ComponentSource, opts Options) ([]*unstructured.Unstructured, error) {
+	var objects []*unstructured.Unstructured
+	var err error
+	switch {
+	case source.Kustomize != "" && source.Chart == nil:
+		var path string
+		if path, err = sourcePath(opts.SourceDir, source.Kustomize); err != nil {
+			return nil, err
+		}
+		objects, err = renderKustomize(path)
+	case source.Chart != nil && source.Kustomize == "":
+		var chrt *chart.Chart
+		if chrt, err = loadChart(ctx, opts, source.Chart); err != nil {
+			return nil, err
+		}
+		objects, err = renderChart(chrt, component, instance.Namespace, source.Chart.Values)
+	default:
+		return nil, fmt.Errorf("exactly one of kustomize and chart must be set")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, obj := range objects {
+		if !sourceKind(obj.GroupVersionKind().GroupKind()) {
+			return nil, fmt.Errorf("%s %s: kind %s is not supported in component sources, which may only render %v",
+				obj.GetKind(), obj.GetName(), obj.GroupVersionKind().GroupKind(), SourceKinds)
+		}
+		if obj.GetNamespace() != "" && obj.GetNamespace() != instance.Namespace {
+			return nil, fmt.Errorf("%s %s is in namespace %s, not the namespace of the Mesh", obj.GetKind(), obj.GetName(), obj.GetNamespace())
+		}
+		obj.SetNamespace(instance.Namespace)
+	}
+	return objects, nil
+}
+
+func sourceKind(gk schema.GroupKind) bool {
+	for _, kind := range SourceKinds {
+		if gk == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// sourcePath resolves a path of a component source within dir.
+func sourcePath(dir, path string) (string, error) {
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf("source path %q must be relative and stay within the source directory", path)
+	}
+	return filepath.Join(dir, path), nil
+}
+
+// loadChart loads a chart from the source directory or pulls it from an OCI
+// registry.
+func loadChart(ctx context.Context, opts Options, source *v1beta1.ChartSource) (*chart.Chart, error) {
+	switch {
+	case source.Path != "" && source.Ref == "":
+		path, err := sourcePath(opts.SourceDir, source.Path)
+		if err != nil {
+			return nil, err
+		}
+		return loader.Load(path)
+	case source.Ref != "" && source.Path == "":
+		keychain := opts.ChartKeychain
+		if keychain == nil {
+			keychain = authn.NewMultiKeychain()
+		}
+		return opts.Charts.pull(ctx, source.Ref, keychain)
+	default:
+		return nil, fmt.Errorf("exactly one of path and ref must be set on a chart")
+	}
+}
+
+// renderKustomize builds the kustomization in dir.
+func renderKustomize(dir string) ([]*unstructured.Unstructured, error) {
+	resources, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(filesys.MakeFsOnDisk(), dir)
+	if err != nil {
+		return nil, err
+	}
+	var objects []*unstructured.Unstructured
+	for _, resource := range resources.Resources() {
+		data, err := resource.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		obj := &unstructured.Unstructured{}
+		if err := obj.UnmarshalJSON(data); err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// renderChart renders the templates of chrt as a release called name in
+// namespace. Hooks and empty documents are left out.
+func renderChart(chrt *chart.Chart, name, namespace string, values *runtime.RawExtension) ([]*unstructured.Unstructured, error) {
+	overrides := map[string]interface{}{}
+	if values != nil && len(values.Raw) > 0 {
+		if err := json.Unmarshal(values.Raw, &overrides); err != nil {
+			return nil, fmt.Errorf("chart values: %w", err)
+		}
+	}
+	renderValues, err := chartutil.ToRenderValues(chrt, overrides, chartutil.ReleaseOptions{
+		Name:      name,
+		Namespace: namespace,
+		IsInstall: true,
+	}, chartutil.DefaultCapabilities)
+	if err != nil {
+		return nil, err
+	}
+	files, err := engine.Render(chrt, renderValues)
+	if err != nil {
+		return nil, err
+	}
+
+	fileNames := make([]string, 0, len(files))
+	for fileName := range files {
+		if strings.HasSuffix(fileName, ".yaml") || strings.HasSuffix(fileName, ".yml") {
+			fileNames = append(fileNames, fileName)
+		}
+	}
+	sort.Strings(fileNames)
+
+	var objects []*unstructured.Unstructured
+	for _, fileName := range fileNames {
+		manifests := releaseutil.SplitManifests(files[fileName])
+		keys := make([]string, 0, len(manifests))
+		for key := range manifests {
+			keys = append(keys, key)
+		}
+		sort.Sort(releaseutil.BySplitManifestsOrder(keys))
+		for _, key := range keys {
+			data, err := yaml.YAMLToJSON([]byte(manifests[key]))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", fileName, err)
+			}
+			if len(bytes.TrimSpace(data)) == 0 || string(bytes.TrimSpace(data)) == "null" {
+				continue
+			}
+			obj := &unstructured.Unstructured{}
+			if err := obj.UnmarshalJSON(data); err != nil {
+				return nil, fmt.Errorf("%s: %w", fileName, err)
+			}
+			if _, hook := obj.GetAnnotations()["helm.sh/hook"]; hook {
+				continue
+			}
+			objects = append(objects, obj)
+		}
+	}
+	return objects, nil
+}
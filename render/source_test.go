@@ -0,0 +1,50 @@
+package render
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v3/pkg/chart/loader"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+func TestRenderChart(t *testing.T) {
+	chrt, err := loader.Load("testdata/sources/chart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects, err := renderChart(chrt, Backend, "default", &runtime.RawExtension{Raw: []byte(`{"replicaCount":3}`)})
+	if err != nil {
+		t.Fatalf("renderChart: %v", err)
+	}
+
+	var kinds []string
+	for _, obj := range objects {
+		kinds = append(kinds, obj.GetKind()+"/"+obj.GetName())
+	}
+	if len(objects) != 2 || kinds[0] != "Deployment/backend" || kinds[1] != "Service/backend" {
+		t.Fatalf("rendered %v, want the Deployment and Service without the test hook", kinds)
+	}
+	replicas, _, _ := unstructured.NestedInt64(objects[0].Object, "spec", "replicas")
+	if replicas != 3 {
+		t.Errorf("replicas: got %d, want the overridden 3", replicas)
+	}
+}
+
+func TestSourceKinds(t *testing.T) {
+	mesh := &v1beta1.Mesh{ObjectMeta: metav1.ObjectMeta{Name: "mesh-sample", Namespace: "default"}}
+	objects, err := Source(context.Background(), mesh, Backend, &v1beta1.ComponentSource{Kustomize: "kustomize"}, Options{SourceDir: "testdata/sources"})
+	if err != nil || len(objects) != 2 {
+		t.Fatalf("Source: got %d objects, %v, want the Deployment and Service", len(objects), err)
+	}
+
+	_, err = Source(context.Background(), mesh, Backend, &v1beta1.ComponentSource{Kustomize: "kustomize-cluster-role"}, Options{SourceDir: "testdata/sources"})
+	if err == nil || !strings.Contains(err.Error(), "ClusterRole backend: kind ClusterRole.rbac.authorization.k8s.io is not supported") {
+		t.Errorf("source with a ClusterRole: got %v, want the kind rejected", err)
+	}
+}
@@ -0,0 +1,61 @@
+package render
+
+import (
+	corev1 "k8s.io/api/core/v1"
+
+	v1beta1 "github.com/vilayilarun/pkg/api/v1beta1"
+)
+
+// ApplyTemplate replaces the components of instance with their effective
+// settings: the defaults of template, overridden by the Mesh's own settings.
+func ApplyTemplate(instance *v1beta1.Mesh, template *v1beta1.MeshTemplate) {
+	components := &instance.Spec.Components
+	components.Frontend.ComponentTemplate = mergeComponent(template.Spec.Components.Frontend, components.Frontend.ComponentTemplate)
+	components.Backend.ComponentTemplate = mergeComponent(template.Spec.Components.Backend, components.Backend.ComponentTemplate)
+	components.App.ComponentTemplate = mergeComponent(template.Spec.Components.App, components.App.ComponentTemplate)
+}
+
+// mergeComponent returns defaults with every field set in overrides replaced.
+// Lists are merged by key, with the entries of overrides winning.
+func mergeComponent(defaults, overrides v1beta1.ComponentTemplate) v1beta1.ComponentTemplate {
+	merged := *defaults.DeepCopy()
+	overrides = *overrides.DeepCopy()
+	if overrides.Image != "" {
+		merged.Image = overrides.Image
+	}
+	if overrides.Replicas != nil {
+		merged.Replicas = overrides.Replicas
+	}
+	if overrides.Resources != nil {
+		merged.Resources = overrides.Resources
+	}
+	if overrides.LivenessProbe != nil {
+		merged.LivenessProbe = overrides.LivenessProbe
+	}
+	if overrides.ReadinessProbe != nil {
+		merged.ReadinessProbe = overrides.ReadinessProbe
+	}
+	merged.Env = mergeList(merged.Env, overrides.Env, func(env corev1.EnvVar) string { return env.Name })
+	merged.Volumes = mergeList(merged.Volumes, overrides.Volumes, func(volume corev1.Volume) string { return volume.Name })
+	merged.VolumeMounts = mergeList(merged.VolumeMounts, overrides.VolumeMounts, func(mount corev1.VolumeMount) string { return mount.MountPath })
+	return merged
+}
+
+// mergeList replaces the entries of defaults that have the same key as an
+// entry of overrides, and appends the other entries of overrides.
+func mergeList[T any](defaults, overrides []T, key func(T) string) []T {
+	merged := append([]T(nil), defaults...)
+	for _, override := range overrides {
+		replaced := false
+		for i := range merged {
+			if key(merged[i]) == key(override) {
+				merged[i] = override
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, override)
+		}
+	}
+	return merged
+}